@@ -0,0 +1,63 @@
+package btree
+
+import (
+	"iter"
+	"math"
+)
+
+// The iterators below yield every key along with its node. Ranges are
+// half-open, like [lo, hi).
+
+// All yields every key in ascending order
+func (b *BTree) All() iter.Seq2[int, *Node] {
+	return b.Ascend(math.MinInt)
+}
+
+// Ascend yields the keys >= from in ascending order
+func (b *BTree) Ascend(from int) iter.Seq2[int, *Node] {
+	return func(yield func(int, *Node) bool) {
+		b.Root.ascend(from, yield)
+	}
+}
+
+// Descend yields the keys <= from in descending order
+func (b *BTree) Descend(from int) iter.Seq2[int, *Node] {
+	return func(yield func(int, *Node) bool) {
+		b.Root.descend(from, yield)
+	}
+}
+
+// Between yields the keys in [lo, hi) in ascending order
+func (b *BTree) Between(lo, hi int) iter.Seq2[int, *Node] {
+	return func(yield func(int, *Node) bool) {
+		b.Root.ascend(lo, func(k int, n *Node) bool {
+			return k < hi && yield(k, n)
+		})
+	}
+}
+
+// ascend visits the keys >= lo below n, and returns false once yield does
+func (n *Node) ascend(lo int, yield func(int, *Node) bool) bool {
+	if n == nil {
+		return true
+	}
+	if n.key >= lo {
+		if !n.Left.ascend(lo, yield) || !yield(n.key, n) {
+			return false
+		}
+	}
+	return n.Right.ascend(lo, yield)
+}
+
+// descend visits the keys <= hi below n, from the largest
+func (n *Node) descend(hi int, yield func(int, *Node) bool) bool {
+	if n == nil {
+		return true
+	}
+	if n.key <= hi {
+		if !n.Right.descend(hi, yield) || !yield(n.key, n) {
+			return false
+		}
+	}
+	return n.Left.descend(hi, yield)
+}
@@ -0,0 +1,111 @@
+package btree
+
+import (
+	"iter"
+	"math/rand"
+	"slices"
+	"testing"
+)
+
+func keysOf(seq iter.Seq2[int, *Node]) []int {
+	var res []int
+	for k, n := range seq {
+		if n.key != k {
+			panic("key does not match its node")
+		}
+		res = append(res, k)
+	}
+	return res
+}
+
+// The iterators skip removed keys, whichever of the removal cases took them
+// out
+func TestIterators(t *testing.T) {
+	tree := New()
+	keys := rand.New(rand.NewSource(1)).Perm(20)
+	for _, k := range keys {
+		tree.Insert(2 * k)
+	}
+	// the root, and then keys in all parts of the tree
+	removed := []int{2 * keys[0], 0, 38, 20, 22, 10}
+	for _, k := range removed {
+		tree.Remove(k)
+	}
+	var model []int
+	for k := 0; k < 40; k += 2 {
+		if !slices.Contains(removed, k) {
+			model = append(model, k)
+		}
+	}
+	between := func(lo, hi int) []int {
+		var res []int
+		for _, k := range model {
+			if lo <= k && k < hi {
+				res = append(res, k)
+			}
+		}
+		return res
+	}
+	descending := func(keys []int) []int {
+		keys = slices.Clone(keys)
+		slices.Reverse(keys)
+		return keys
+	}
+
+	cases := []struct {
+		desc string
+		seq  iter.Seq2[int, *Node]
+		want []int
+	}{
+		{"all", tree.All(), model},
+		{"ascend", tree.Ascend(19), between(19, 40)},
+		{"ascend/removed", tree.Ascend(20), between(20, 40)},
+		{"descend", tree.Descend(25), descending(between(0, 26))},
+		{"between", tree.Between(18, 30), between(18, 30)},
+		{"between/removed", tree.Between(19, 24), nil},
+		{"empty", New().All(), nil},
+	}
+	for _, tc := range cases {
+		t.Run(tc.desc, func(t *testing.T) {
+			if got := keysOf(tc.seq); !slices.Equal(got, tc.want) {
+				t.Fatalf("got %v, want %v", got, tc.want)
+			}
+		})
+	}
+
+	for _, k := range model {
+		tree.Remove(k)
+	}
+	if got := keysOf(tree.All()); got != nil {
+		t.Fatalf("got %v after removing every key", got)
+	}
+}
+
+// Stopping a loop early stops the iterator
+func TestIteratorsBreak(t *testing.T) {
+	tree := New().Insert(5, 2, 8, 1, 3, 7, 9)
+	cases := []struct {
+		desc string
+		seq  iter.Seq2[int, *Node]
+		want []int
+	}{
+		{"all", tree.All(), []int{1, 2}},
+		{"ascend", tree.Ascend(4), []int{5, 7}},
+		{"descend", tree.Descend(6), []int{5, 3}},
+		{"between", tree.Between(2, 9), []int{2, 3}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.desc, func(t *testing.T) {
+			var got []int
+			for k := range tc.seq {
+				got = append(got, k)
+				if len(got) == 2 {
+					break
+				}
+			}
+			if !slices.Equal(got, tc.want) {
+				t.Fatalf("got %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
@@ -59,7 +59,9 @@ func (b *BTree) Remove(key int) *BTree {
 	switch z.countDirectChildren() {
 	case 0:
 		// no children...
-		if par.Left == z {
+		if par == nil {
+			b.Root = nil
+		} else if par.Left == z {
 			par.Left = nil
 		} else {
 			par.Right = nil
@@ -72,6 +74,9 @@ func (b *BTree) Remove(key int) *BTree {
 			// right successor should just be moved up; we do that by
 			// moving the value over and then removing it
 			z.Right = s.Right
+			if s.Right != nil {
+				s.Right.Parent = z
+			}
 			z.key = s.key
 
 		} else {
@@ -91,6 +96,7 @@ func (b *BTree) Remove(key int) *BTree {
 func (b *BTree) transplant(old, new *Node) {
 	// a node takes over for old. Hijacks its children. Assume it's child-less
 	par := old.Parent
+	new.Parent = par
 	if par == nil {
 		b.Root = new
 		return
@@ -100,7 +106,6 @@ func (b *BTree) transplant(old, new *Node) {
 	} else if par.Right == old {
 		par.Right = new
 	}
-	new.Parent = par
 }
 
 func (n *Node) Find(key int) *Node {
@@ -0,0 +1,179 @@
+package bplus
+
+import "slices"
+
+// B-link trees
+//
+// With Options.BLink, the tree is a Lehman-Yao B-link tree. Every node has a
+// high key, which bounds the keys in and below it, and a link to its right
+// sibling on the same level. A split moves the upper half of a node to a new
+// right sibling, and hands it the old high key, so the keys that moved are
+// still reachable from the node through the link until the parent knows
+// about the new node.
+//
+// That lets readers and writers hold a single latch on the way down. A node
+// reached from a stale parent may have been split in the meantime, and then
+// the key is at or past its high key; they move right until it's not.
+// Writers go back up after a split, holding the split node while they latch
+// the parent, so they hold at most two latches at a time. Latches are taken
+// bottom-up and left to right, so there are no deadlocks.
+//
+// Each split is committed before the parent is changed, so a crash may leave
+// a node that the parent doesn't know about. It's still reached through the
+// link, and the tree works as before, but isValid rejects it. A cut off split
+// of the root is finished when the tree is opened.
+//
+// Nodes are never merged or freed, so Delete only removes the key from its
+// leaf, and nodes may be left with fewer keys than a B+ tree allows.
+
+// openLink finds the height of an opened B-link tree. If a crash cut off a
+// split of the root, there's more than one node on the root level, and a new
+// root is put above them.
+func (T *BTree[K, V]) openLink() {
+	for n := T.load(T.Root.PageID); ; {
+		if n.Leaf {
+			T.unpin(n)
+			break
+		}
+		c := T.read(n, 0)
+		T.unpin(n)
+		n = c
+		T.height++
+	}
+	if T.Root.RightSibling == nil {
+		return
+	}
+
+	w := T.writer()
+	root := T.allocate()
+	for n := T.load(T.Root.PageID); ; {
+		root.Children = append(root.Children, n.PageID)
+		T.unpin(n)
+		if n.HighKey == nil {
+			break
+		}
+		root.Keys = append(root.Keys, *n.HighKey)
+		n = T.load(*n.RightSibling)
+	}
+	w.write(root)
+	w.setRoot(root)
+	T.height++
+	w.mustCommit()
+	T.unpin(root)
+}
+
+// pathTo returns the nodes visited on the way to the node at the given
+// height where key belongs, from the root down. Leaves are at height 0. Only
+// one node is latched at a time.
+func (T *BTree[K, V]) pathTo(key K, height int) []PageID {
+	r := T.toKey(key)
+	T.rootLatch.RLock()
+	n, level := T.load(T.Root.PageID), T.height
+	T.rootLatch.RUnlock()
+	T.latches.get(n.PageID).RLock()
+	var path []PageID
+	for {
+		for n.HighKey != nil && r.past(*n.HighKey) {
+			next := *n.RightSibling
+			T.runlatch(n)
+			n = T.rlatch(next)
+		}
+		path = append(path, n.PageID)
+		if level == height {
+			T.runlatch(n)
+			return path
+		}
+		id := n.Children[r.child(n)]
+		T.runlatch(n)
+		n = T.rlatch(id)
+		level--
+	}
+}
+
+// moveRight write latches the node on the level of n where key belongs,
+// starting at n, which is latched
+func (T *BTree[K, V]) moveRight(n *Node[K, V], key K) *Node[K, V] {
+	for n.HighKey != nil && T.compare(key, *n.HighKey) >= 0 {
+		next := *n.RightSibling
+		T.wunlatch(n)
+		n = T.wlatch(next)
+	}
+	return n
+}
+
+// insertLink is Insert for B-link trees. After a split, the parent is found
+// on the path taken down, or by going down again if the tree has grown.
+func (T *BTree[K, V]) insertLink(key K, value V) {
+	defer T.validate()
+	w := T.writer()
+
+	path := T.pathTo(key, 0)
+	n := T.moveRight(T.wlatch(path[len(path)-1]), key)
+	path = path[:len(path)-1]
+	if T.replace(n, key, value) {
+		w.write(n)
+		w.mustCommit()
+		T.wunlatch(n)
+		return
+	}
+
+	// the leaf gets the value, and parents of split nodes get the new node
+	var child PageID
+	for height := 0; ; height++ {
+		T.insertInNode(n, key, value, child)
+		if !T.NeedsSplit(n) {
+			w.write(n)
+			w.mustCommit()
+			T.wunlatch(n)
+			return
+		}
+		right, sep := w.split(n, (T.n+1)/2)
+		w.mustCommit()
+
+		// n is the root, unless the tree has grown since we passed it
+		if len(path) == 0 {
+			T.rootLatch.Lock()
+			if T.Root.PageID == n.PageID {
+				root := T.allocate()
+				root.Keys = []K{sep}
+				root.Children = []PageID{n.PageID, right.PageID}
+				w.write(root)
+				w.setRoot(root)
+				T.height++
+				w.mustCommit()
+				T.rootLatch.Unlock()
+				T.unpin(root)
+				T.unpin(right)
+				T.wunlatch(n)
+				return
+			}
+			T.rootLatch.Unlock()
+			path = T.pathTo(sep, height+1)
+		}
+		par := T.moveRight(T.wlatch(path[len(path)-1]), sep)
+		path = path[:len(path)-1]
+		T.unpin(right)
+		T.wunlatch(n)
+		n, key, child = par, sep, right.PageID
+	}
+}
+
+// deleteLink is Delete for B-link trees
+func (T *BTree[K, V]) deleteLink(key K) bool {
+	defer T.validate()
+	w := T.writer()
+
+	path := T.pathTo(key, 0)
+	n := T.moveRight(T.wlatch(path[len(path)-1]), key)
+	defer T.wunlatch(n)
+
+	j, found := slices.BinarySearchFunc(n.Keys, key, T.compare)
+	if !found {
+		return false
+	}
+	n.Keys = slices.Delete(n.Keys, j, j+1)
+	n.Values = slices.Delete(n.Values, j, j+1)
+	w.write(n)
+	w.mustCommit()
+	return true
+}
@@ -0,0 +1,151 @@
+package bplus
+
+import (
+	"io"
+	"math/rand"
+	"slices"
+	"testing"
+)
+
+func TestBLink(t *testing.T) {
+	f := &memFile{}
+	opts := Options{PageSize: 256, Frames: 20, BLink: true, Validate: true}
+	tree, err := Open(3, f, opts, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := rand.New(rand.NewSource(8)).Perm(300)
+	for _, k := range keys {
+		tree.Insert(k, PageID(k))
+	}
+	for _, k := range keys[:100] {
+		if !tree.Delete(k) {
+			t.Fatalf("Delete(%d) = false", k)
+		}
+	}
+	if tree.Delete(keys[0]) {
+		t.Fatalf("Delete(%d) of a deleted key = true", keys[0])
+	}
+	if err := tree.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	// high keys and links are read back
+	reopened, err := Open(3, f, opts, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := reopened.isValid(); err != nil {
+		t.Fatal(err)
+	}
+	if reopened.height != tree.height || tree.height < 2 {
+		t.Fatalf("height = %d; want %d", reopened.height, tree.height)
+	}
+	want := slices.Sorted(slices.Values(keys[100:]))
+	if got := rangeKeys(reopened); !slices.Equal(got, want) {
+		t.Fatalf("keys mismatch;\nwant= %v\ngot = %v", want, got)
+	}
+	var got []int
+	for k := range reopened.Descend(1000) {
+		got = append(got, k)
+	}
+	slices.Reverse(got)
+	if !slices.Equal(got, want) {
+		t.Fatalf("descending keys mismatch;\nwant= %v\ngot = %v", want, got)
+	}
+}
+
+func TestBLinkMoveRight(t *testing.T) {
+	tree, err := Open(3, &memFile{}, Options{PageSize: 256, BLink: true}, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for k := range 20 {
+		tree.Insert(k, PageID(k))
+	}
+
+	// split a leaf without telling its parent, like a writer that has yet
+	// to go back up
+	leaf := tree.load(tree.pathTo(10, 0)[0])
+	w := tree.writer()
+	w.split(leaf, 1)
+	w.mustCommit()
+	tree.unpin(leaf)
+	if err := tree.isValid(); err == nil {
+		t.Fatalf("expected the half split tree to be invalid")
+	}
+
+	for k := range 20 {
+		if m := tree.Find(k); m == nil || m.Key() != k {
+			t.Fatalf("Find(%d) = %v", k, m)
+		}
+	}
+	if got := rangeKeys(tree); len(got) != 20 {
+		t.Fatalf("keys = %v", got)
+	}
+}
+
+func TestBLinkRecovery(t *testing.T) {
+	data, log := &memFile{}, &memFile{}
+	opts := Options{PageSize: 128, WAL: log, BLink: true}
+	tree, err := Open(3, data, opts, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := rand.New(rand.NewSource(9)).Perm(25)
+	for _, k := range keys {
+		tree.Insert(k, PageID(k))
+	}
+
+	// a crash may cut off a split before its parent is changed, but no key
+	// is lost, and the tree keeps working
+	crashLog := slices.Clone(log.b)
+	var last int
+	for off := 0; off <= len(crashLog); off++ {
+		d := &memFile{}
+		l := &memFile{b: slices.Clone(crashLog[:off])}
+		reopened, err := Open(3, d, Options{PageSize: 128, WAL: l, BLink: true}, io.Discard)
+		if err != nil {
+			t.Fatalf("offset %d: failed to reopen: %s", off, err)
+		}
+		got := rangeKeys(reopened)
+		if len(got) < last || !slices.IsSorted(got) {
+			t.Fatalf("offset %d: unexpected keys %v", off, got)
+		}
+		last = len(got)
+		for _, k := range keys {
+			if m := reopened.Find(k); m == nil || m.Key() != k {
+				reopened.Insert(k, PageID(k))
+			}
+		}
+		if got := rangeKeys(reopened); len(got) != len(keys) {
+			t.Fatalf("offset %d: keys after inserting the rest = %v", off, got)
+		}
+	}
+	if last != len(keys) {
+		t.Fatalf("expected all inserts to be recovered from the full log; got %d of %d", last, len(keys))
+	}
+}
+
+func TestBLinkBulkLoad(t *testing.T) {
+	tree, err := Open(4, &memFile{}, Options{PageSize: 256, BLink: true}, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tree.BulkLoad(pairs(200), 0.7); err != nil {
+		t.Fatal(err)
+	}
+	if tree.height < 2 {
+		t.Fatalf("height = %d", tree.height)
+	}
+	for k := 1; k < 400; k += 2 {
+		tree.Insert(k, PageID(k))
+	}
+	if got := rangeKeys(tree); len(got) != 400 {
+		t.Fatalf("got %d keys; want 400", len(got))
+	}
+}
+
+func TestBLinkConcurrent(t *testing.T) {
+	testConcurrent(t, Options{PageSize: 256, Frames: 64, BLink: true})
+}
@@ -0,0 +1,229 @@
+package bplus
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// Policy decides which frame is evicted when the buffer pool is full
+type Policy int
+
+const (
+	LRU Policy = iota
+	Clock
+)
+
+func (p Policy) String() string {
+	switch p {
+	case LRU:
+		return "LRU"
+	case Clock:
+		return "Clock"
+	}
+	return fmt.Sprintf("Policy(%d)", int(p))
+}
+
+var ErrNoFrames = errors.New("buffer pool: all frames are pinned")
+
+type frame[K, V any] struct {
+	node  *Node[K, V] // nil if the frame is empty
+	pins  int
+	dirty bool
+	used  uint64 // LRU: tick of last access
+	ref   bool   // CLOCK: reference bit
+}
+
+// BufferPool keeps up to a fixed number of nodes in memory. Pinned nodes are
+// never evicted, and dirty nodes are written back to the pager when they're
+// evicted or the pool is flushed. It's safe for concurrent use, but the
+// nodes are not; see BTree for how they're latched.
+type BufferPool[K, V any] struct {
+	mu     sync.Mutex
+	pager  *Pager[K, V]
+	policy Policy
+	frames []frame[K, V]
+	table  map[PageID]int // page -> frame index
+	tick   uint64
+	hand   int // CLOCK: next frame to consider
+}
+
+func NewBufferPool[K, V any](pager *Pager[K, V], size int, policy Policy) *BufferPool[K, V] {
+	return &BufferPool[K, V]{
+		pager:  pager,
+		policy: policy,
+		frames: make([]frame[K, V], size),
+		table:  make(map[PageID]int),
+	}
+}
+
+func (bp *BufferPool[K, V]) touch(i int) {
+	bp.tick++
+	bp.frames[i].used = bp.tick
+	bp.frames[i].ref = true
+}
+
+// Pin returns the node with the given id, reading it from the pager if it's
+// not in the pool. Every Pin must be matched by an Unpin.
+func (bp *BufferPool[K, V]) Pin(id PageID) (*Node[K, V], error) {
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+	if i, ok := bp.table[id]; ok {
+		bp.pager.count(func(s *Stats) { s.Hits++ })
+		bp.frames[i].pins++
+		bp.touch(i)
+		return bp.frames[i].node, nil
+	}
+	bp.pager.count(func(s *Stats) { s.Misses++ })
+	i, err := bp.victim()
+	if err != nil {
+		return nil, err
+	}
+	n, err := bp.pager.Read(id)
+	if err != nil {
+		return nil, err
+	}
+	bp.install(i, n, false)
+	bp.frames[i].pins++
+	return n, nil
+}
+
+// Stats returns a snapshot of the counters of the pool and its pager
+func (bp *BufferPool[K, V]) Stats() Stats {
+	return bp.pager.Stats()
+}
+
+func (bp *BufferPool[K, V]) Unpin(id PageID) {
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+	i, ok := bp.table[id]
+	if !ok || bp.frames[i].pins == 0 {
+		panic(fmt.Sprintf("buffer pool: unpin of page %d that is not pinned", id))
+	}
+	bp.frames[i].pins--
+}
+
+// MarkDirty registers n as modified, so it's written back later. If the page
+// is not in the pool, n takes a frame.
+func (bp *BufferPool[K, V]) MarkDirty(n *Node[K, V]) error {
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+	if i, ok := bp.table[n.PageID]; ok {
+		bp.frames[i].node = n
+		bp.frames[i].dirty = true
+		bp.touch(i)
+		return nil
+	}
+	i, err := bp.victim()
+	if err != nil {
+		return err
+	}
+	bp.install(i, n, true)
+	return nil
+}
+
+// Allocate returns a new node, pinned and dirty
+func (bp *BufferPool[K, V]) Allocate() (*Node[K, V], error) {
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+	i, err := bp.victim()
+	if err != nil {
+		return nil, err
+	}
+	n, err := bp.pager.Allocate()
+	if err != nil {
+		return nil, err
+	}
+	bp.install(i, n, true)
+	bp.frames[i].pins++
+	return n, nil
+}
+
+// Free drops the page from the pool, without writing it, and releases it
+func (bp *BufferPool[K, V]) Free(id PageID) error {
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+	if i, ok := bp.table[id]; ok {
+		if bp.frames[i].pins > 0 {
+			return fmt.Errorf("buffer pool: free of pinned page %d", id)
+		}
+		bp.frames[i] = frame[K, V]{}
+		delete(bp.table, id)
+	}
+	return bp.pager.Free(id)
+}
+
+// Flush writes all dirty nodes to the pager. They stay in the pool. Nodes
+// must not be changed while the pool is flushed.
+func (bp *BufferPool[K, V]) Flush() error {
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+	for i := range bp.frames {
+		f := &bp.frames[i]
+		if f.node == nil || !f.dirty {
+			continue
+		}
+		if err := bp.pager.Write(f.node); err != nil {
+			return err
+		}
+		f.dirty = false
+	}
+	return nil
+}
+
+func (bp *BufferPool[K, V]) install(i int, n *Node[K, V], dirty bool) {
+	bp.frames[i] = frame[K, V]{node: n, dirty: dirty}
+	bp.table[n.PageID] = i
+	bp.touch(i)
+}
+
+// victim returns an empty frame, evicting a node if necessary
+func (bp *BufferPool[K, V]) victim() (int, error) {
+	for i := range bp.frames {
+		if bp.frames[i].node == nil {
+			return i, nil
+		}
+	}
+	i := -1
+	switch bp.policy {
+	case LRU:
+		for j, f := range bp.frames {
+			if f.pins == 0 && (i == -1 || f.used < bp.frames[i].used) {
+				i = j
+			}
+		}
+	case Clock:
+		// two rounds; the first might just clear reference bits
+		for range 2 * len(bp.frames) {
+			j := bp.hand
+			bp.hand = (bp.hand + 1) % len(bp.frames)
+			f := &bp.frames[j]
+			if f.pins > 0 {
+				continue
+			}
+			if f.ref {
+				f.ref = false
+				continue
+			}
+			i = j
+			break
+		}
+	}
+	if i == -1 {
+		return 0, ErrNoFrames
+	}
+	return i, bp.evict(i)
+}
+
+func (bp *BufferPool[K, V]) evict(i int) error {
+	f := &bp.frames[i]
+	if f.dirty {
+		if err := bp.pager.Write(f.node); err != nil {
+			return err
+		}
+	}
+	bp.pager.count(func(s *Stats) { s.Evictions++ })
+	delete(bp.table, f.node.PageID)
+	*f = frame[K, V]{}
+	return nil
+}
@@ -0,0 +1,163 @@
+package bplus
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func newTestPool(t *testing.T, pages, frames int, policy Policy) *BufferPool[int, PageID] {
+	t.Helper()
+	pager, err := NewPager(&memFile{}, 128, NewLogger(io.Discard), nil, IntSchema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < pages; i++ {
+		n, _ := pager.Allocate()
+		n.Leaf = true
+		n.Keys = []int{i + 1}
+		n.Values = []PageID{0}
+		if err := pager.Write(n); err != nil {
+			t.Fatal(err)
+		}
+	}
+	pager.stats = Stats{}
+	return NewBufferPool(pager, frames, policy)
+}
+
+// pins and unpins the given pages in order
+func touch(t *testing.T, bp *BufferPool[int, PageID], ids ...PageID) {
+	t.Helper()
+	for _, id := range ids {
+		if _, err := bp.Pin(id); err != nil {
+			t.Fatal(err)
+		}
+		bp.Unpin(id)
+	}
+}
+
+func expectResident(t *testing.T, bp *BufferPool[int, PageID], want ...PageID) {
+	t.Helper()
+	if len(bp.table) != len(want) {
+		t.Fatalf("want %d resident pages, got %d: %v", len(want), len(bp.table), bp.table)
+	}
+	for _, id := range want {
+		if _, ok := bp.table[id]; !ok {
+			t.Fatalf("expected page %d to be resident: %v", id, bp.table)
+		}
+	}
+}
+
+func TestBufferPoolEviction(t *testing.T) {
+	cases := []struct {
+		policy Policy
+		want   []PageID
+	}{
+		// 1 is least recently used
+		{policy: LRU, want: []PageID{2, 3, 4}},
+		// all reference bits are set, so the hand sweeps around once,
+		// clears them, and picks the first frame
+		{policy: Clock, want: []PageID{2, 3, 4}},
+	}
+	for _, tc := range cases {
+		t.Run(fmt.Sprint(tc.policy), func(t *testing.T) {
+			bp := newTestPool(t, 4, 3, tc.policy)
+			touch(t, bp, 1, 2, 3, 4)
+			expectResident(t, bp, tc.want...)
+			if s := bp.Stats(); s.Misses != 4 || s.Hits != 0 || s.Evictions != 1 {
+				t.Fatalf("unexpected stats: %+v", s)
+			}
+		})
+	}
+
+	t.Run("LRU recency", func(t *testing.T) {
+		bp := newTestPool(t, 4, 3, LRU)
+		touch(t, bp, 1, 2, 3, 1, 4)
+		expectResident(t, bp, 1, 3, 4)
+	})
+	t.Run("Clock second chance", func(t *testing.T) {
+		bp := newTestPool(t, 5, 3, Clock)
+		touch(t, bp, 1, 2, 3, 4) // evicts 1, clears bits of 2 and 3
+		touch(t, bp, 3)          // 3 gets its bit back
+		touch(t, bp, 5)          // 2 has no bit set, so it goes
+		expectResident(t, bp, 3, 4, 5)
+	})
+}
+
+func TestBufferPoolPinned(t *testing.T) {
+	bp := newTestPool(t, 3, 2, LRU)
+	a, _ := bp.Pin(1)
+	bp.Pin(2)
+	if _, err := bp.Pin(3); !errors.Is(err, ErrNoFrames) {
+		t.Fatalf("want ErrNoFrames, got %v", err)
+	}
+	bp.Unpin(2)
+
+	// a is dirty, but pinned; 2 gets evicted instead
+	a.Keys = append(a.Keys, 99)
+	a.Values = append(a.Values, 0)
+	if err := bp.MarkDirty(a); err != nil {
+		t.Fatal(err)
+	}
+	touch(t, bp, 3)
+	expectResident(t, bp, 1, 3)
+	if bp.Stats().Writes != 0 {
+		t.Fatalf("expected no writes before the dirty page is evicted")
+	}
+	bp.Unpin(1)
+	touch(t, bp, 2) // 1 is least recently used now
+	expectResident(t, bp, 2, 3)
+	if bp.Stats().Writes != 1 {
+		t.Fatalf("expected dirty page to be written on eviction; writes=%d", bp.Stats().Writes)
+	}
+	n, _ := bp.pager.Read(1)
+	if len(n.Keys) != 2 {
+		t.Fatalf("expected written page to have 2 keys, got %v", n.Keys)
+	}
+}
+
+func TestBufferPoolTree(t *testing.T) {
+	for _, policy := range []Policy{LRU, Clock} {
+		t.Run(fmt.Sprint(policy), func(t *testing.T) {
+			f := &memFile{}
+			tree, err := Open(3, f, Options{PageSize: 256, Frames: 20, Policy: policy, Validate: true}, io.Discard)
+			if err != nil {
+				t.Fatal(err)
+			}
+			keys := rand.New(rand.NewSource(2)).Perm(300)
+			for _, k := range keys {
+				tree.Insert(k, PageID(k))
+			}
+			if tree.Stats().Evictions == 0 {
+				t.Fatalf("expected evictions with %d frames", len(tree.pool.frames))
+			}
+			for _, k := range keys {
+				if m := tree.Find(k); m == nil || m.Node.Values[m.Index] != PageID(k) {
+					t.Fatalf("failed to find %d; got %s", k, m)
+				}
+			}
+			if err := tree.Flush(); err != nil {
+				t.Fatal(err)
+			}
+
+			reopened, err := Open(3, f, Options{PageSize: 256}, io.Discard)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var count int
+			it := reopened.Range(math.MinInt, math.MaxInt)
+			for m := it.Next(); m != nil; m = it.Next() {
+				if m.Node.Keys[m.Index] != count {
+					t.Fatalf("want key %d, got %d", count, m.Node.Keys[m.Index])
+				}
+				count++
+			}
+			if count != len(keys) {
+				t.Fatalf("want %d keys, got %d", len(keys), count)
+			}
+		})
+	}
+}
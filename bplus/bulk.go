@@ -0,0 +1,237 @@
+package bplus
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"slices"
+)
+
+var (
+	ErrUnsorted = errors.New("bulk load: input is not sorted")
+	ErrNotEmpty = errors.New("bulk load: tree is not empty")
+)
+
+// BulkLoad builds a tree in memory from pairs sorted by key, with nodes as
+// large as a page of DefaultPageSize allows; see BTree.BulkLoad
+func BulkLoad(sortedPairs iter.Seq2[int, PageID], fillFactor float64) (*BTree[int, PageID], error) {
+	T := New(maxKeys(DefaultPageSize, IntSchema), io.Discard)
+	if err := T.BulkLoad(sortedPairs, fillFactor); err != nil {
+		return nil, err
+	}
+	return T, nil
+}
+
+// childRef is a node on the level being built, and the smallest key below it
+type childRef[K any] struct {
+	key K
+	id  PageID
+}
+
+// BulkLoad fills an empty tree from pairs with strictly increasing keys. The
+// leaf level is built left to right, and then the internal levels bottom-up.
+// Nodes are filled to fillFactor, which is in (0, 1], but never below the
+// minimum occupancy.
+//
+// Nodes are committed as they're completed, but they're not reachable until
+// the top node is copied to the root at the very end. The root is latched
+// meanwhile, so other operations wait for the load. If the input turns out to
+// be unsorted, ErrUnsorted is returned and the tree is left empty.
+func (T *BTree[K, V]) BulkLoad(pairs iter.Seq2[K, V], fillFactor float64) error {
+	root := T.latchRoot(true)
+	defer T.wunlatch(root)
+	if !root.Leaf || len(root.Keys) > 0 {
+		return ErrNotEmpty
+	}
+	if fillFactor <= 0 || fillFactor > 1 {
+		return fmt.Errorf("bulk load: fill factor %v is not in (0, 1]", fillFactor)
+	}
+	perNode := func(least int) int {
+		return max(least, int(fillFactor*float64(T.n)))
+	}
+
+	w := T.writer()
+	leaves, err := w.loadLeaves(pairs, perNode((T.n+1)/2))
+	if err != nil {
+		return err
+	}
+	if len(leaves) == 0 {
+		return nil
+	}
+	level, height := leaves, 0
+	for len(level) > 1 {
+		if level, err = w.loadLevel(level, perNode(T.n-(T.n+1)/2)+1); err != nil {
+			return err
+		}
+		height++
+	}
+
+	// the root stays where it is, so readers that are on their way to it
+	// don't need to be waited for
+	top := T.load(level[0].id)
+	root.Leaf, root.Keys, root.Values, root.Children = top.Leaf, top.Keys, top.Values, top.Children
+	w.write(root)
+	T.unpin(top)
+	T.free(top)
+	if T.blink {
+		T.rootLatch.Lock()
+		T.height = height
+		T.rootLatch.Unlock()
+	}
+	defer T.validate()
+	return w.commit()
+}
+
+// done commits n, which is complete, and unpins it
+func (w *writer[K, V]) done(n *Node[K, V]) error {
+	w.write(n)
+	err := w.commit()
+	w.unpin(n)
+	return err
+}
+
+// link makes right the right sibling of left, where right starts at key. In
+// a B-link tree, internal nodes are linked too, and key is the high key of
+// left.
+func (w *writer[K, V]) link(left, right *Node[K, V], key K) {
+	if !left.Leaf && !w.blink {
+		return
+	}
+	id := right.PageID
+	left.RightSibling = &id
+	if w.blink {
+		left.HighKey = &key
+	}
+}
+
+// loadLeaves writes the leaf level, and returns its leaves. The last two
+// leaves are held back until the end, since the last one may be too small.
+func (w *writer[K, V]) loadLeaves(pairs iter.Seq2[K, V], per int) ([]childRef[K], error) {
+	var leaves []childRef[K]
+	var prev, cur *Node[K, V]
+
+	var err error
+	for k, v := range pairs {
+		if cur != nil && len(cur.Keys) > 0 && w.compare(cur.Keys[len(cur.Keys)-1], k) >= 0 {
+			err = fmt.Errorf("%w: %s after %s", ErrUnsorted, keyString(k), keyString(cur.Keys[len(cur.Keys)-1]))
+			break
+		}
+		if cur == nil || len(cur.Keys) == per {
+			next := w.allocate()
+			next.Leaf = true
+			if cur != nil {
+				w.link(cur, next, k)
+			}
+			if prev != nil {
+				err = w.done(prev)
+				prev = nil
+			}
+			prev, cur = cur, next
+			leaves = append(leaves, childRef[K]{key: k, id: next.PageID})
+			if err != nil {
+				break
+			}
+		}
+		cur.Keys = append(cur.Keys, k)
+		cur.Values = append(cur.Values, v)
+	}
+	if err != nil {
+		// nothing points to the leaves yet, so they can just be dropped
+		for _, n := range []*Node[K, V]{prev, cur} {
+			if n != nil {
+				w.unpin(n)
+			}
+		}
+		for _, l := range leaves {
+			w.free(&Node[K, V]{PageID: l.id})
+		}
+		return nil, errors.Join(err, w.commit())
+	}
+	if cur == nil {
+		return nil, nil
+	}
+
+	if prev != nil && len(cur.Keys) < (w.n+1)/2 {
+		a, b := balanceTail(len(prev.Keys), len(cur.Keys), w.n)
+		keys := append(prev.Keys, cur.Keys...)
+		values := append(prev.Values, cur.Values...)
+		prev.Keys, prev.Values = keys[:a:a], values[:a:a]
+		cur.Keys, cur.Values = slices.Clone(keys[a:]), slices.Clone(values[a:])
+		if b == 0 {
+			prev.RightSibling, prev.HighKey = nil, nil
+			w.unpin(cur)
+			w.free(cur)
+			leaves = leaves[:len(leaves)-1]
+			cur = nil
+		} else {
+			w.link(prev, cur, cur.Keys[0])
+			leaves[len(leaves)-1].key = cur.Keys[0]
+		}
+	}
+	for _, n := range []*Node[K, V]{prev, cur} {
+		if n == nil {
+			continue
+		}
+		if err := w.done(n); err != nil {
+			return nil, err
+		}
+	}
+	return leaves, nil
+}
+
+// loadLevel writes the internal nodes above children, per children to a
+// node, and returns them. Each node is held back until the next one is
+// allocated, so they can be linked.
+func (w *writer[K, V]) loadLevel(children []childRef[K], per int) ([]childRef[K], error) {
+	sizes := make([]int, 0, len(children)/per+1)
+	for left := len(children); left > 0; left -= per {
+		sizes = append(sizes, min(per, left))
+	}
+	// a node with the fewest keys allowed has one more child than that
+	if k := len(sizes); k > 1 && sizes[k-1] < w.n-(w.n+1)/2+1 {
+		a, b := balanceTail(sizes[k-2], sizes[k-1], w.n+1)
+		sizes = append(sizes[:k-2], a)
+		if b > 0 {
+			sizes = append(sizes, b)
+		}
+	}
+
+	var level []childRef[K]
+	var prev *Node[K, V]
+	for _, size := range sizes {
+		group := children[:size]
+		children = children[size:]
+		n := w.allocate()
+		for i, c := range group {
+			if i > 0 {
+				n.Keys = append(n.Keys, c.key)
+			}
+			n.Children = append(n.Children, c.id)
+		}
+		level = append(level, childRef[K]{key: group[0].key, id: n.PageID})
+		if prev != nil {
+			w.link(prev, n, group[0].key)
+			if err := w.done(prev); err != nil {
+				w.unpin(n)
+				return nil, err
+			}
+		}
+		prev = n
+	}
+	if err := w.done(prev); err != nil {
+		return nil, err
+	}
+	return level, nil
+}
+
+// balanceTail evens out the last two nodes of a level, when the last one is
+// too small. They're merged if they fit in one node, in which case the second
+// size is 0.
+func balanceTail(prev, last, capacity int) (int, int) {
+	total := prev + last
+	if total <= capacity {
+		return total, 0
+	}
+	return total - total/2, total / 2
+}
@@ -0,0 +1,135 @@
+package bplus
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"slices"
+	"testing"
+)
+
+// pairs yields keys 0, 2, 4, ... with the key as value
+func pairs(count int) iter.Seq2[int, PageID] {
+	return func(yield func(int, PageID) bool) {
+		for i := range count {
+			if !yield(2*i, PageID(2*i)) {
+				return
+			}
+		}
+	}
+}
+
+func TestBulkLoad(t *testing.T) {
+	for _, n := range []int{3, 4} {
+		for _, count := range []int{0, 1, 2, 5, 50, 333} {
+			for _, fill := range []float64{0.5, 0.7, 1} {
+				t.Run(fmt.Sprintf("%d/%d/%v", n, count, fill), func(t *testing.T) {
+					tree, err := Open(n, &memFile{}, Options{PageSize: 256}, io.Discard)
+					if err != nil {
+						t.Fatal(err)
+					}
+					if err := tree.BulkLoad(pairs(count), fill); err != nil {
+						t.Fatal(err)
+					}
+					if err := tree.isValid(); err != nil {
+						t.Fatal(err)
+					}
+					var want []int
+					for k := range pairs(count) {
+						want = append(want, k)
+					}
+					if got := rangeKeys(tree); !slices.Equal(got, want) {
+						t.Fatalf("keys = %v; want %v", got, want)
+					}
+
+					// the tree is usable afterwards
+					for i := range 20 {
+						tree.Insert(2*i+1, 0)
+					}
+					for i := range min(count, 20) {
+						tree.Delete(2 * i)
+					}
+					if err := tree.isValid(); err != nil {
+						t.Fatal(err)
+					}
+				})
+			}
+		}
+	}
+}
+
+func TestBulkLoadFull(t *testing.T) {
+	tree, err := BulkLoad(pairs(1000), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var leaves int
+	tree.WalkNodes(tree.Root, func(n *Node[int, PageID]) {
+		if n.Leaf {
+			leaves++
+		}
+	})
+	per := maxKeys(DefaultPageSize, IntSchema)
+	if want := (1000 + per - 1) / per; leaves != want {
+		t.Fatalf("%d leaves; want %d with %d keys each", leaves, want, per)
+	}
+}
+
+func TestBulkLoadErrors(t *testing.T) {
+	tree, err := Open(3, &memFile{}, Options{PageSize: 256}, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unsorted := func(yield func(int, PageID) bool) {
+		for k := range pairs(20) {
+			if !yield(k, 0) {
+				return
+			}
+		}
+		yield(7, 0)
+	}
+	if err := tree.BulkLoad(unsorted, 1); !errors.Is(err, ErrUnsorted) {
+		t.Fatalf("want ErrUnsorted, got %v", err)
+	}
+	if got := rangeKeys(tree); got != nil {
+		t.Fatalf("tree has keys %v after a failed load", got)
+	}
+	if tree.pager.freeHead == 0 {
+		t.Fatalf("pages of the failed load were not freed")
+	}
+
+	if err := tree.BulkLoad(pairs(10), 0); err == nil {
+		t.Fatalf("want an error for fill factor 0")
+	}
+	if err := tree.BulkLoad(pairs(10), 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := tree.BulkLoad(pairs(10), 1); !errors.Is(err, ErrNotEmpty) {
+		t.Fatalf("want ErrNotEmpty, got %v", err)
+	}
+}
+
+func TestBulkLoadRecovery(t *testing.T) {
+	data, log := &memFile{}, &memFile{}
+	opts := Options{PageSize: 256, WAL: log}
+	tree, err := Open(3, data, opts, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tree.BulkLoad(pairs(100), 0.7); err != nil {
+		t.Fatal(err)
+	}
+
+	// crash before anything is flushed
+	reopened, err := Open(3, data, opts, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := rangeKeys(reopened); len(got) != 100 {
+		t.Fatalf("recovered %d keys; want 100", len(got))
+	}
+	if err := reopened.isValid(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,148 @@
+package bplus
+
+import (
+	"io"
+	"math/rand"
+	"slices"
+	"sync"
+	"testing"
+)
+
+func TestConcurrent(t *testing.T) {
+	testConcurrent(t, Options{PageSize: 256, Frames: 64})
+}
+
+// A tree made with New is safe for concurrent use as it is
+func TestConcurrentNew(t *testing.T) {
+	tree := New(4, io.Discard)
+	const workers, size = 4, 5000
+	var wg sync.WaitGroup
+	errs := make(chan string, workers)
+	for w := range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for k := w; k < size; k += workers {
+				tree.Insert(k, PageID(k))
+				if m := tree.Find(k); m == nil || m.Key() != k || m.Value() != PageID(k) {
+					errs <- "Find missed a key that was just inserted"
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+	for k := range size {
+		if m := tree.Find(k); m == nil || m.Key() != k {
+			t.Fatalf("Find(%d) = %v", k, m)
+		}
+	}
+}
+
+func testConcurrent(t *testing.T, opts Options) {
+	tree, err := Open(4, &memFile{}, opts, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// even keys are there from the start, and are never deleted. Writers
+	// insert odd keys, and delete every other one again.
+	const size = 2000
+	for k := 0; k < size; k += 2 {
+		tree.Insert(k, PageID(k))
+	}
+	const writers, readers = 8, 4
+	var want []int
+	for k := 0; k < size; k++ {
+		if k%2 == 0 || k%4 == 1 {
+			want = append(want, k)
+		}
+	}
+
+	var wg sync.WaitGroup
+	done := make(chan struct{})
+	errs := make(chan string, writers+readers)
+	for w := range writers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var keys []int
+			for k := 2*w + 1; k < size; k += 2 * writers {
+				keys = append(keys, k)
+			}
+			rng := rand.New(rand.NewSource(int64(w)))
+			rng.Shuffle(len(keys), func(i, j int) { keys[i], keys[j] = keys[j], keys[i] })
+			for _, k := range keys {
+				tree.Insert(k, PageID(k))
+			}
+			for _, k := range keys {
+				if k%4 == 3 && !tree.Delete(k) {
+					errs <- "Delete of an inserted key failed"
+					return
+				}
+			}
+		}()
+	}
+
+	var readWG sync.WaitGroup
+	for r := range readers {
+		readWG.Add(1)
+		go func() {
+			defer readWG.Done()
+			rng := rand.New(rand.NewSource(int64(100 + r)))
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				k := 2 * rng.Intn(size/2)
+				if m := tree.Find(k); m == nil || m.Key() != k || m.Value() != PageID(k) {
+					errs <- "Find missed a key that was never deleted"
+					return
+				}
+				// the pool reads a node only after counting a miss
+				if s := tree.Stats(); s.Reads > s.Misses {
+					errs <- "Stats has more reads than misses"
+					return
+				}
+				lo := 2 * rng.Intn(size/2)
+				var evens int
+				prev := -1
+				it := tree.Range(lo, lo+100)
+				for m := it.Next(); m != nil; m = it.Next() {
+					if m.Key() <= prev {
+						errs <- "Range is not increasing"
+						return
+					}
+					prev = m.Key()
+					if prev%2 == 0 {
+						evens++
+					}
+				}
+				if evens != min(50, (size-lo)/2) {
+					errs <- "Range missed keys that were never deleted"
+					return
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+	close(done)
+	readWG.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+
+	if err := tree.isValid(); err != nil {
+		t.Fatal(err)
+	}
+	if got := rangeKeys(tree); !slices.Equal(got, want) {
+		t.Fatalf("keys mismatch;\nwant= %v\ngot = %v", want, got)
+	}
+}
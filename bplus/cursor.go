@@ -0,0 +1,136 @@
+package bplus
+
+import "slices"
+
+// Cursor moves back and forth over the entries of a tree. It keeps a copy of
+// its leaf, along with the range of keys that belong in it, and steps to the
+// neighbouring leaves by seeking from the root to just outside that range.
+//
+// The cursor holds no pins or latches. If the tree is changed, the leaf is
+// copied again on the next move by seeking to the current key.
+type Cursor[K, V any] struct {
+	T       *BTree[K, V]
+	leaf    *Node[K, V] // a copy, never changed
+	index   int
+	lo, hi  *K     // keys in [lo, hi) belong in leaf; nil is unbounded
+	version uint64 // of the tree when leaf was copied
+	valid   bool
+
+	// the current entry
+	key   K
+	value V
+}
+
+// Cursor returns an unpositioned cursor; call First, Last or one of the
+// Seek methods before anything else.
+func (T *BTree[K, V]) Cursor() *Cursor[K, V] {
+	return &Cursor[K, V]{T: T}
+}
+
+func (c *Cursor[K, V]) Valid() bool { return c.valid }
+func (c *Cursor[K, V]) Key() K      { return c.key }
+func (c *Cursor[K, V]) Value() V    { return c.value }
+
+// First moves to the smallest key, and reports whether there is one
+func (c *Cursor[K, V]) First() bool {
+	c.load(route[K, V]{
+		child: func(n *Node[K, V]) int { return 0 },
+		past:  func(K) bool { return false },
+	})
+	c.index = 0
+	return c.settle(true)
+}
+
+// Last moves to the largest key, and reports whether there is one
+func (c *Cursor[K, V]) Last() bool {
+	c.load(route[K, V]{
+		child: func(n *Node[K, V]) int { return len(n.Children) - 1 },
+		past:  func(K) bool { return true },
+	})
+	c.index = len(c.leaf.Keys) - 1
+	return c.settle(false)
+}
+
+// SeekGE moves to the smallest key >= key
+func (c *Cursor[K, V]) SeekGE(key K) bool {
+	c.load(c.T.toKey(key))
+	c.index, _ = slices.BinarySearchFunc(c.leaf.Keys, key, c.T.compare)
+	return c.settle(true)
+}
+
+// SeekLE moves to the largest key <= key
+func (c *Cursor[K, V]) SeekLE(key K) bool {
+	c.load(c.T.toKey(key))
+	i, found := slices.BinarySearchFunc(c.leaf.Keys, key, c.T.compare)
+	if !found {
+		i--
+	}
+	c.index = i
+	return c.settle(false)
+}
+
+// seekLT moves to the largest key < key
+func (c *Cursor[K, V]) seekLT(key K) bool {
+	c.load(c.T.belowKey(key))
+	i, _ := slices.BinarySearchFunc(c.leaf.Keys, key, c.T.compare)
+	c.index = i - 1
+	return c.settle(false)
+}
+
+// Next moves to the next key, and reports whether there is one
+func (c *Cursor[K, V]) Next() bool {
+	if !c.valid {
+		return false
+	}
+	if c.version != c.T.version.Load() {
+		key := c.key
+		if !c.SeekGE(key) || c.T.compare(c.key, key) != 0 {
+			return c.valid
+		}
+	}
+	c.index++
+	return c.settle(true)
+}
+
+// Prev moves to the previous key, and reports whether there is one
+func (c *Cursor[K, V]) Prev() bool {
+	if !c.valid {
+		return false
+	}
+	if c.version != c.T.version.Load() {
+		key := c.key
+		if !c.SeekLE(key) || c.T.compare(c.key, key) != 0 {
+			return c.valid
+		}
+	}
+	c.index--
+	return c.settle(false)
+}
+
+// load copies the leaf at the end of r. The version is read first, so
+// changes made during the descent are noticed.
+func (c *Cursor[K, V]) load(r route[K, V]) {
+	c.version = c.T.version.Load()
+	c.leaf, c.lo, c.hi = c.T.descend(r)
+}
+
+// settle moves to the neighbouring leaf while the index is past either end
+// of the current one, and then loads the entry
+func (c *Cursor[K, V]) settle(forward bool) bool {
+	for c.index < 0 || c.index >= len(c.leaf.Keys) {
+		switch {
+		case forward && c.hi != nil:
+			hi := *c.hi
+			c.load(c.T.toKey(hi))
+			c.index, _ = slices.BinarySearchFunc(c.leaf.Keys, hi, c.T.compare)
+		case !forward && c.lo != nil:
+			return c.seekLT(*c.lo)
+		default:
+			c.valid = false
+			return false
+		}
+	}
+	c.key, c.value = c.leaf.Keys[c.index], c.leaf.Values[c.index]
+	c.valid = true
+	return true
+}
@@ -0,0 +1,113 @@
+package bplus
+
+import (
+	"io"
+	"math/rand"
+	"slices"
+	"testing"
+)
+
+func newCursorTree(t *testing.T, keys []int) *BTree[int, PageID] {
+	t.Helper()
+	tree, err := Open(3, &memFile{}, Options{PageSize: 256, Frames: 20, Validate: true}, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, k := range keys {
+		tree.Insert(k, PageID(k))
+	}
+	return tree
+}
+
+func TestCursor(t *testing.T) {
+	// even keys, so there's something between them to seek to
+	var keys []int
+	for _, k := range rand.New(rand.NewSource(7)).Perm(50) {
+		keys = append(keys, 2*k)
+	}
+	tree := newCursorTree(t, keys)
+	slices.Sort(keys)
+
+	var got []int
+	c := tree.Cursor()
+	for ok := c.First(); ok; ok = c.Next() {
+		if c.Value() != PageID(c.Key()) {
+			t.Fatalf("key %d has value %d", c.Key(), c.Value())
+		}
+		got = append(got, c.Key())
+	}
+	if !slices.Equal(got, keys) {
+		t.Fatalf("forward = %v; want %v", got, keys)
+	}
+
+	got = nil
+	for ok := c.Last(); ok; ok = c.Prev() {
+		got = append(got, c.Key())
+	}
+	want := slices.Clone(keys)
+	slices.Reverse(want)
+	if !slices.Equal(got, want) {
+		t.Fatalf("backward = %v; want %v", got, want)
+	}
+
+	cases := []struct {
+		key        int
+		ge, le     int
+		geOK, leOK bool
+	}{
+		{key: 10, ge: 10, le: 10, geOK: true, leOK: true},
+		{key: 11, ge: 12, le: 10, geOK: true, leOK: true},
+		{key: -1, ge: 0, geOK: true},
+		{key: 99, le: 98, leOK: true},
+	}
+	for _, tc := range cases {
+		if ok := c.SeekGE(tc.key); ok != tc.geOK || (ok && c.Key() != tc.ge) {
+			t.Fatalf("SeekGE(%d) = %v/%d; want %v/%d", tc.key, ok, c.Key(), tc.geOK, tc.ge)
+		}
+		if ok := c.SeekLE(tc.key); ok != tc.leOK || (ok && c.Key() != tc.le) {
+			t.Fatalf("SeekLE(%d) = %v/%d; want %v/%d", tc.key, ok, c.Key(), tc.leOK, tc.le)
+		}
+	}
+
+	// the latest 5 keys below 50
+	got = nil
+	for ok := c.SeekLE(49); ok && len(got) < 5; ok = c.Prev() {
+		got = append(got, c.Key())
+	}
+	if want := []int{48, 46, 44, 42, 40}; !slices.Equal(got, want) {
+		t.Fatalf("latest = %v; want %v", got, want)
+	}
+}
+
+func TestCursorEmpty(t *testing.T) {
+	c := newCursorTree(t, nil).Cursor()
+	if c.First() || c.Last() || c.SeekGE(0) || c.SeekLE(0) || c.Next() || c.Prev() {
+		t.Fatalf("cursor on an empty tree is valid")
+	}
+}
+
+func TestCursorChanges(t *testing.T) {
+	tree := newCursorTree(t, []int{10, 20, 30, 40, 50, 60, 70, 80})
+	c := tree.Cursor()
+	if !c.SeekGE(40) {
+		t.Fatal("SeekGE(40) = false")
+	}
+
+	// the current key is deleted, and keys are added around it
+	tree.Delete(40)
+	tree.Insert(45, 45)
+	tree.Insert(35, 35)
+	for i := range 20 {
+		tree.Insert(100+i, 0) // splits nodes on the path
+	}
+	if !c.Next() || c.Key() != 45 {
+		t.Fatalf("Next after changes = %d; want 45", c.Key())
+	}
+	tree.Delete(45)
+	if !c.Prev() || c.Key() != 35 {
+		t.Fatalf("Prev after changes = %d; want 35", c.Key())
+	}
+	if !c.Next() || c.Key() != 50 {
+		t.Fatalf("Next = %d; want 50", c.Key())
+	}
+}
@@ -0,0 +1,207 @@
+package bplus
+
+import (
+	"slices"
+)
+
+// minKeys is the fewest keys a node other than the root may hold. The
+// bounds follow from Split: a leaf keeps ceil[n/2] keys, and an internal
+// node gives up its separator key to the parent.
+func (T *BTree[K, V]) minKeys(n *Node[K, V]) int {
+	if n.Leaf {
+		return (T.n + 1) / 2
+	}
+	return T.n - (T.n+1)/2
+}
+
+func (T *BTree[K, V]) underflows(n *Node[K, V]) bool {
+	return n.PageID != T.Root.PageID && len(n.Keys) < T.minKeys(n)
+}
+
+// childIndex returns the index of the child whose subtree may hold key.
+// Keys equal to a separator are found to its right.
+func (T *BTree[K, V]) childIndex(key K, node *Node[K, V]) int {
+	i, found := slices.BinarySearchFunc(node.Keys, key, T.compare)
+	if found {
+		return i + 1
+	}
+	return i
+}
+
+// mayUnderflow reports whether n may underflow after one key less, i.e.
+// whether it's not safe for Delete. The root is safe unless it may collapse.
+func (T *BTree[K, V]) mayUnderflow(n *Node[K, V], root bool) bool {
+	if root {
+		return !n.Leaf && len(n.Keys) <= 1
+	}
+	return len(n.Keys) <= T.minKeys(n)
+}
+
+// Delete removes key from the tree, and reports whether it was present.
+func (T *BTree[K, V]) Delete(key K) bool {
+	if T.blink {
+		return T.deleteLink(key)
+	}
+	defer T.validate()
+	w := T.writer()
+
+	// held is the path of write latched nodes, from the highest one that may
+	// change down to the leaf, and index[i] is the child of held[i] on the
+	// path. The root latch is held while the root may collapse, so held[0]
+	// is the root if and only if rootLatched.
+	var held []*Node[K, V]
+	var index []int
+	T.rootLatch.Lock()
+	rootLatched := true
+	release := func() {
+		for _, n := range held {
+			T.wunlatch(n)
+		}
+		held, index = nil, nil
+		if rootLatched {
+			T.rootLatch.Unlock()
+			rootLatched = false
+		}
+	}
+	node := T.wlatch(T.Root.PageID)
+	for level := 0; ; level++ {
+		if !T.mayUnderflow(node, level == 0) {
+			release()
+		}
+		held = append(held, node)
+		if node.Leaf {
+			break
+		}
+		i := T.childIndex(key, node)
+		index = append(index, i)
+		node = T.wlatch(node.Children[i])
+	}
+
+	var siblings, freed []*Node[K, V]
+	defer func() {
+		if err := w.commit(); err != nil {
+			panic(err)
+		}
+		release()
+		for _, n := range siblings {
+			T.wunlatch(n)
+		}
+		// pages can only be freed once they're no longer pinned, and they're
+		// unreachable once the parents are committed
+		for _, n := range freed {
+			T.free(n)
+		}
+		if err := w.commit(); err != nil {
+			panic(err)
+		}
+	}()
+
+	j, found := slices.BinarySearchFunc(node.Keys, key, T.compare)
+	if !found {
+		return false
+	}
+	node.Keys = slices.Delete(node.Keys, j, j+1)
+	node.Values = slices.Delete(node.Values, j, j+1)
+	w.write(node)
+
+	// walk up while nodes underflow; a merge removes a key from the parent,
+	// which may in turn underflow. Only held[0] may be the root, and it has
+	// no parent, so the nodes checked here never are.
+	for level := len(held) - 2; level >= 0 && len(node.Keys) < T.minKeys(node); level-- {
+		par, i := held[level], index[level]
+		var left, right *Node[K, V]
+		if i > 0 {
+			left = T.wlatch(par.Children[i-1])
+			siblings = append(siblings, left)
+		}
+		if i < len(par.Keys) {
+			right = T.wlatch(par.Children[i+1])
+			siblings = append(siblings, right)
+		}
+
+		switch {
+		case left != nil && len(left.Keys) > T.minKeys(left):
+			w.borrowLeft(par, i, left, node)
+		case right != nil && len(right.Keys) > T.minKeys(right):
+			w.borrowRight(par, i, node, right)
+		case left != nil:
+			w.merge(par, i-1, left, node)
+			freed = append(freed, node)
+		default:
+			w.merge(par, i, node, right)
+			freed = append(freed, right)
+		}
+		node = par
+	}
+
+	// an internal root left with a single child is replaced by that child,
+	// which is already latched
+	if root := held[0]; rootLatched && !root.Leaf && len(root.Keys) == 0 {
+		child := T.load(root.Children[0])
+		w.setRoot(child)
+		T.unpin(child)
+		freed = append(freed, root)
+	}
+	return true
+}
+
+// borrowLeft moves the last entry of left into node, which is the i'th
+// child of par.
+func (w *writer[K, V]) borrowLeft(par *Node[K, V], i int, left, node *Node[K, V]) {
+	last := len(left.Keys) - 1
+	if node.Leaf {
+		node.Keys = slices.Insert(node.Keys, 0, left.Keys[last])
+		node.Values = slices.Insert(node.Values, 0, left.Values[last])
+		left.Values = left.Values[:last]
+		par.Keys[i-1] = node.Keys[0]
+	} else {
+		// the separator comes down, and left's last key goes up
+		node.Keys = slices.Insert(node.Keys, 0, par.Keys[i-1])
+		node.Children = slices.Insert(node.Children, 0, left.Children[last+1])
+		left.Children = left.Children[:last+1]
+		par.Keys[i-1] = left.Keys[last]
+	}
+	left.Keys = left.Keys[:last]
+	w.write(left)
+	w.write(node)
+	w.write(par)
+}
+
+// borrowRight moves the first entry of right into node, which is the i'th
+// child of par.
+func (w *writer[K, V]) borrowRight(par *Node[K, V], i int, node, right *Node[K, V]) {
+	if node.Leaf {
+		node.Keys = append(node.Keys, right.Keys[0])
+		node.Values = append(node.Values, right.Values[0])
+		right.Keys = slices.Delete(right.Keys, 0, 1)
+		right.Values = slices.Delete(right.Values, 0, 1)
+		par.Keys[i] = right.Keys[0]
+	} else {
+		node.Keys = append(node.Keys, par.Keys[i])
+		node.Children = append(node.Children, right.Children[0])
+		par.Keys[i] = right.Keys[0]
+		right.Keys = slices.Delete(right.Keys, 0, 1)
+		right.Children = slices.Delete(right.Children, 0, 1)
+	}
+	w.write(right)
+	w.write(node)
+	w.write(par)
+}
+
+// merge moves everything in right into left, and removes the separator at
+// index i from par. The caller frees right.
+func (w *writer[K, V]) merge(par *Node[K, V], i int, left, right *Node[K, V]) {
+	if left.Leaf {
+		left.Keys = append(left.Keys, right.Keys...)
+		left.Values = append(left.Values, right.Values...)
+		left.RightSibling = right.RightSibling
+	} else {
+		left.Keys = append(left.Keys, par.Keys[i])
+		left.Keys = append(left.Keys, right.Keys...)
+		left.Children = append(left.Children, right.Children...)
+	}
+	par.Keys = slices.Delete(par.Keys, i, i+1)
+	par.Children = slices.Delete(par.Children, i+1, i+2)
+	w.write(left)
+	w.write(par)
+}
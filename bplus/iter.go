@@ -0,0 +1,43 @@
+package bplus
+
+import "iter"
+
+// The iterators below are built on Cursor, so they hold no pins between
+// steps, and pick up changes made to the tree while iterating. Ranges are
+// half-open, like [lo, hi).
+
+// All yields every entry in ascending order
+func (T *BTree[K, V]) All() iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		c := T.Cursor()
+		for ok := c.First(); ok && yield(c.Key(), c.Value()); ok = c.Next() {
+		}
+	}
+}
+
+// Ascend yields the entries with keys >= from in ascending order
+func (T *BTree[K, V]) Ascend(from K) iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		c := T.Cursor()
+		for ok := c.SeekGE(from); ok && yield(c.Key(), c.Value()); ok = c.Next() {
+		}
+	}
+}
+
+// Descend yields the entries with keys <= from in descending order
+func (T *BTree[K, V]) Descend(from K) iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		c := T.Cursor()
+		for ok := c.SeekLE(from); ok && yield(c.Key(), c.Value()); ok = c.Prev() {
+		}
+	}
+}
+
+// Between yields the entries with keys in [lo, hi) in ascending order
+func (T *BTree[K, V]) Between(lo, hi K) iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		c := T.Cursor()
+		for ok := c.SeekGE(lo); ok && T.compare(c.Key(), hi) < 0 && yield(c.Key(), c.Value()); ok = c.Next() {
+		}
+	}
+}
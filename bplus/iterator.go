@@ -4,7 +4,9 @@ type Iterator[T any] interface {
 	Next() *T
 }
 
-type RangeIterator = Iterator[Match]
+type RangeIterator[K, V any] interface {
+	Iterator[Match[K, V]]
+}
 
 type iterator[T any] struct {
 	next func() *T
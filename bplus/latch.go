@@ -0,0 +1,225 @@
+package bplus
+
+import (
+	"slices"
+	"sync"
+)
+
+// Concurrency
+//
+// Every node has a read/write latch, and operations couple them top-down:
+// a child is latched before its parent is released. Readers release the
+// parent right away. Writers keep the parent while the child is not safe,
+// that is while the change might reach the parent: a split for Insert, and
+// a borrow or merge for Delete. Siblings are only latched by a writer that
+// holds their parent exclusively.
+//
+// Nobody waits for a latch while holding one on the same level or below, so
+// there are no deadlocks. That's why readers never follow RightSibling while
+// holding a latch; they go back to the root for the next leaf instead.
+//
+// The root pointer has its own latch, which is coupled like a node's. Only
+// pinned nodes are latched, and pins are released before the latches. A
+// writer that holds the latch of a node it took from a latched parent is then
+// the only one with a pin on it, so it may free the node once it's done.
+
+// latchTable hands out a latch per page
+type latchTable struct {
+	mu sync.Mutex
+	m  map[PageID]*sync.RWMutex
+}
+
+func (l *latchTable) get(id PageID) *sync.RWMutex {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.m == nil {
+		l.m = make(map[PageID]*sync.RWMutex)
+	}
+	latch, ok := l.m[id]
+	if !ok {
+		latch = &sync.RWMutex{}
+		l.m[id] = latch
+	}
+	return latch
+}
+
+// rlatch pins the node and takes its read latch
+func (T *BTree[K, V]) rlatch(id PageID) *Node[K, V] {
+	n := T.load(id)
+	T.latches.get(id).RLock()
+	return n
+}
+func (T *BTree[K, V]) runlatch(n *Node[K, V]) {
+	T.unpin(n)
+	T.latches.get(n.PageID).RUnlock()
+}
+
+// wlatch pins the node and takes its write latch
+func (T *BTree[K, V]) wlatch(id PageID) *Node[K, V] {
+	n := T.load(id)
+	T.latches.get(id).Lock()
+	return n
+}
+func (T *BTree[K, V]) wunlatch(n *Node[K, V]) {
+	T.unpin(n)
+	T.latches.get(n.PageID).Unlock()
+}
+
+// latchRoot pins and latches the root. In a B+ tree, the root latch is held
+// until the root is latched, so the root can't be freed in between. The root
+// of a B-link tree is never freed, and the root latch is released first; a
+// writer that splits the root takes the root latch while holding the root's.
+func (T *BTree[K, V]) latchRoot(write bool) *Node[K, V] {
+	T.rootLatch.RLock()
+	n := T.load(T.Root.PageID)
+	if T.blink {
+		T.rootLatch.RUnlock()
+	}
+	if write {
+		T.latches.get(n.PageID).Lock()
+	} else {
+		T.latches.get(n.PageID).RLock()
+	}
+	if !T.blink {
+		T.rootLatch.RUnlock()
+	}
+	return n
+}
+
+// A route picks the child to take from an internal node, and says whether
+// the target is at or past a high key. In a B-link tree, a reader that finds
+// the target past a node's high key moves right; see blink.go.
+type route[K, V any] struct {
+	child func(n *Node[K, V]) int
+	past  func(high K) bool
+}
+
+// toKey routes to the leaf where key is or would be
+func (T *BTree[K, V]) toKey(key K) route[K, V] {
+	return route[K, V]{
+		child: func(n *Node[K, V]) int { return T.childIndex(key, n) },
+		past:  func(high K) bool { return T.compare(key, high) >= 0 },
+	}
+}
+
+// belowKey routes to the leaf with the largest keys below key
+func (T *BTree[K, V]) belowKey(key K) route[K, V] {
+	return route[K, V]{
+		child: func(n *Node[K, V]) int {
+			i, _ := slices.BinarySearchFunc(n.Keys, key, T.compare)
+			return i
+		},
+		past: func(high K) bool { return T.compare(key, high) > 0 },
+	}
+}
+
+// descend walks from the root to a leaf with read latches, along r. It
+// returns a copy of the leaf, and the range [lo, hi) of keys that belong in
+// it. A nil bound is unbounded.
+//
+// In a B-link tree, the parent is released before the child is latched, and
+// the reader moves right past nodes that were split in between.
+func (T *BTree[K, V]) descend(r route[K, V]) (leaf *Node[K, V], lo, hi *K) {
+	n := T.latchRoot(false)
+	for {
+		for n.HighKey != nil && r.past(*n.HighKey) {
+			k := *n.HighKey
+			lo = &k
+			next := *n.RightSibling
+			T.runlatch(n)
+			n = T.rlatch(next)
+		}
+		if n.Leaf {
+			break
+		}
+		i := r.child(n)
+		// the bounds are copied, since the node may change once released
+		if i > 0 {
+			k := n.Keys[i-1]
+			lo = &k
+		}
+		if i < len(n.Keys) {
+			k := n.Keys[i]
+			hi = &k
+		}
+		id := n.Children[i]
+		if T.blink {
+			T.runlatch(n)
+			n = T.rlatch(id)
+		} else {
+			c := T.rlatch(id)
+			T.runlatch(n)
+			n = c
+		}
+	}
+	leaf = &Node[K, V]{
+		PageID: n.PageID,
+		Leaf:   true,
+		Keys:   slices.Clone(n.Keys),
+		Values: slices.Clone(n.Values),
+		LSN:    n.LSN,
+	}
+	if n.RightSibling != nil {
+		id := *n.RightSibling
+		leaf.RightSibling = &id
+	}
+	if T.blink {
+		// the bound from the parent may be stale, but the high key is not
+		hi = nil
+		if n.HighKey != nil {
+			k := *n.HighKey
+			hi, leaf.HighKey = &k, &k
+		}
+	}
+	T.runlatch(n)
+	return leaf, lo, hi
+}
+
+// writer is a single operation that changes the tree. The nodes it writes
+// are logged together when it commits, and it must keep them latched and
+// pinned until then.
+type writer[K, V any] struct {
+	*BTree[K, V]
+	dirty []*Node[K, V]
+	root  PageID // the new root, or 0 if it's unchanged
+}
+
+func (T *BTree[K, V]) writer() *writer[K, V] {
+	return &writer[K, V]{BTree: T}
+}
+
+func (w *writer[K, V]) write(n *Node[K, V]) *Node[K, V] {
+	if err := w.pool.MarkDirty(n); err != nil {
+		panic(err)
+	}
+	w.version.Add(1)
+	if !slices.Contains(w.dirty, n) {
+		w.dirty = append(w.dirty, n)
+	}
+	return n
+}
+
+// commit logs the changes made so far. Nodes written by the operation must
+// still be pinned, so they're not written to disk before they're logged.
+func (w *writer[K, V]) commit() error {
+	err := w.pager.Commit(w.dirty, w.root)
+	w.dirty = nil
+	w.root = 0
+	return err
+}
+
+func (w *writer[K, V]) mustCommit() {
+	if err := w.commit(); err != nil {
+		panic(err)
+	}
+}
+
+// setRoot makes n the root. The caller holds the root latch exclusively.
+func (w *writer[K, V]) setRoot(n *Node[K, V]) {
+	w.load(n.PageID)
+	if w.Root != nil {
+		w.unpin(w.Root)
+	}
+	w.Root = n
+	w.root = n.PageID
+}
@@ -2,12 +2,15 @@ package bplus
 
 import "fmt"
 
-type Match struct {
-	Node  *Node
+type Match[K, V any] struct {
+	Node  *Node[K, V]
 	Index int
 }
 
-func (m *Match) String() string {
+func (m *Match[K, V]) Key() K   { return m.Node.Keys[m.Index] }
+func (m *Match[K, V]) Value() V { return m.Node.Values[m.Index] }
+
+func (m *Match[K, V]) String() string {
 	if m == nil {
 		return "nil"
 	}
@@ -0,0 +1,119 @@
+package bplus
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"sync/atomic"
+)
+
+// Dup is a key in a tree that allows duplicates. Entries with equal keys are
+// told apart, and kept in insertion order, by a hidden sequence number.
+type Dup[K any] struct {
+	Key K
+	Seq uint64
+}
+
+// DupSchema orders keys like schema, and then by sequence number. The
+// sequence number is stored as a suffix of the encoded key.
+func DupSchema[K, V any](schema Schema[K, V]) Schema[Dup[K], V] {
+	return Schema[Dup[K], V]{
+		Compare: func(a, b Dup[K]) int {
+			if c := schema.Compare(a.Key, b.Key); c != 0 {
+				return c
+			}
+			switch {
+			case a.Seq < b.Seq:
+				return -1
+			case a.Seq > b.Seq:
+				return 1
+			}
+			return 0
+		},
+		Key:   dupCodec[K]{schema.Key},
+		Value: schema.Value,
+	}
+}
+
+type dupCodec[K any] struct {
+	key Codec[K]
+}
+
+func (c dupCodec[K]) Append(b []byte, v Dup[K]) []byte {
+	return binary.BigEndian.AppendUint64(c.key.Append(b, v.Key), v.Seq)
+}
+func (c dupCodec[K]) Decode(b []byte) (Dup[K], error) {
+	if len(b) < 8 {
+		return Dup[K]{}, fmt.Errorf("dup: bad length %d", len(b))
+	}
+	k, err := c.key.Decode(b[:len(b)-8])
+	if err != nil {
+		return Dup[K]{}, err
+	}
+	return Dup[K]{Key: k, Seq: binary.BigEndian.Uint64(b[len(b)-8:])}, nil
+}
+func (c dupCodec[K]) MaxSize() int {
+	if n := c.key.MaxSize(); n > 0 {
+		return n + 8
+	}
+	return 0
+}
+
+// MultiTree is a tree where a key may have many values
+type MultiTree[K, V any] struct {
+	tree *BTree[Dup[K], V]
+	seq  atomic.Uint64 // last sequence number handed out
+}
+
+// OpenMulti returns the tree stored in f, which allows duplicate keys; see
+// OpenWith. The sequence numbers are recovered by reading every leaf.
+func OpenMulti[K, V any](n int, f File, schema Schema[K, V], opts Options, w io.Writer) (*MultiTree[K, V], error) {
+	T, err := OpenWith(n, f, DupSchema(schema), opts, w)
+	if err != nil {
+		return nil, err
+	}
+	M := &MultiTree[K, V]{tree: T}
+	T.WalkNodes(T.Root, func(n *Node[Dup[K], V]) {
+		if !n.Leaf {
+			return
+		}
+		for _, k := range n.Keys {
+			M.seq.Store(max(M.seq.Load(), k.Seq))
+		}
+	})
+	return M, nil
+}
+
+// Insert adds value to key, after any values the key already has
+func (M *MultiTree[K, V]) Insert(key K, value V) {
+	M.tree.Insert(Dup[K]{Key: key, Seq: M.seq.Add(1)}, value)
+}
+
+// FindAll iterates over the values of key, in the order they were inserted
+func (M *MultiTree[K, V]) FindAll(key K) Iterator[V] {
+	it := M.tree.Range(Dup[K]{Key: key}, Dup[K]{Key: key, Seq: math.MaxUint64})
+	return NewIterator(func() *V {
+		m := it.Next()
+		if m == nil {
+			return nil
+		}
+		v := m.Value()
+		return &v
+	})
+}
+
+// Range iterates over entries with keys in [key, upper)
+func (M *MultiTree[K, V]) Range(key, upper K) RangeIterator[Dup[K], V] {
+	return M.tree.Range(Dup[K]{Key: key}, Dup[K]{Key: upper})
+}
+
+// Delete removes the entry with the given key and sequence number, as found
+// by Range
+func (M *MultiTree[K, V]) Delete(key Dup[K]) bool {
+	return M.tree.Delete(key)
+}
+
+func (M *MultiTree[K, V]) Flush() error {
+	return M.tree.Flush()
+}
@@ -0,0 +1,66 @@
+package bplus
+
+import (
+	"io"
+	"slices"
+	"testing"
+)
+
+func findAll[K, V any](M *MultiTree[K, V], key K) []V {
+	var res []V
+	it := M.FindAll(key)
+	for v := it.Next(); v != nil; v = it.Next() {
+		res = append(res, *v)
+	}
+	return res
+}
+
+func TestMultiTree(t *testing.T) {
+	f := &memFile{}
+	opts := Options{PageSize: 256, Frames: 20}
+	schema := StringSchema[int](intValues{})
+	M, err := OpenMulti(3, f, schema, opts, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the values of "b" span many leaves, and are split as they're added
+	want := map[string][]int{}
+	for i := range 60 {
+		key := []string{"a", "b", "b", "c"}[i%4]
+		M.Insert(key, i)
+		want[key] = append(want[key], i)
+	}
+	for _, key := range []string{"a", "b", "c"} {
+		if got := findAll(M, key); !slices.Equal(got, want[key]) {
+			t.Fatalf("FindAll(%q) = %v; want %v", key, got, want[key])
+		}
+	}
+	if got := findAll(M, "x"); got != nil {
+		t.Fatalf("FindAll(%q) = %v; want nothing", "x", got)
+	}
+
+	// remove the first value of "b"
+	it := M.Range("b", "c")
+	if m := it.Next(); m == nil || !M.Delete(m.Key()) {
+		t.Fatalf("could not delete the first value of %q", "b")
+	}
+	want["b"] = want["b"][1:]
+
+	// sequence numbers continue where they left off
+	if err := M.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	M, err = OpenMulti(3, f, schema, opts, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	M.Insert("b", 100)
+	want["b"] = append(want["b"], 100)
+	if got := findAll(M, "b"); !slices.Equal(got, want["b"]) {
+		t.Fatalf("FindAll(%q) = %v; want %v", "b", got, want["b"])
+	}
+	if err := M.tree.isValid(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -1,35 +1,121 @@
 package bplus
 
 import (
+	"encoding/binary"
+	"fmt"
 	"io"
 )
 
-func New(n int, w io.Writer) *BTree {
+const DefaultFrames = 64
+
+type Options struct {
+	PageSize int    // defaults to DefaultPageSize
+	Frames   int    // buffer pool size; defaults to DefaultFrames
+	Policy   Policy // buffer pool eviction policy
+
+	// WAL makes every operation crash safe. Without it, a crash between two
+	// flushes may leave the file in an inconsistent state.
+	WAL LogFile
+
+	// BLink makes the tree a B-link tree; see blink.go. A file must always
+	// be opened with the same setting.
+	BLink bool
+
+	// Validate checks the whole tree after every change, and panics if it's
+	// broken. It's slow, and takes no latches, so it's only for tests that
+	// use the tree from one goroutine.
+	Validate bool
+}
+
+// New returns an empty tree with int keys, kept in memory
+func New(n int, w io.Writer) *BTree[int, PageID] {
+	return NewWith(n, IntSchema, w)
+}
+
+// NewWith returns an empty tree with the given schema, kept in memory
+func NewWith[K, V any](n int, schema Schema[K, V], w io.Writer) *BTree[K, V] {
+	T, err := OpenWith(n, &memFile{}, schema, Options{}, w)
+	if err != nil {
+		panic(err)
+	}
+	return T
+}
+
+// Open returns the tree with int keys stored in f; see OpenWith
+func Open(n int, f File, opts Options, w io.Writer) (*BTree[int, PageID], error) {
+	return OpenWith(n, f, IntSchema, opts, w)
+}
+
+// OpenWith returns the tree stored in f, or a new empty tree if f is empty.
+// Changes are not written to f until the tree is flushed, or nodes are
+// evicted from the buffer pool. If a WAL is given, it is replayed first.
+func OpenWith[K, V any](n int, f File, schema Schema[K, V], opts Options, w io.Writer) (*BTree[K, V], error) {
+	pageSize := opts.PageSize
+	if pageSize == 0 {
+		pageSize = DefaultPageSize
+	}
+	frames := opts.Frames
+	if frames == 0 {
+		frames = DefaultFrames
+	}
+
+	limit := maxKeys(pageSize, schema)
+	if opts.BLink {
+		limit-- // the high key takes no more room than a cell
+	}
+	if maxKeys(pageSize, schema) > 0 && n > limit {
+		return nil, fmt.Errorf("open: %d keys do not fit in a page of %d bytes", n, pageSize)
+	}
 	log := NewLogger(w)
-	b := &BTree{
-		n:         n,
-		log:       log,
-		dbg:       true,
-		pageCache: NewPageCache(log),
+	pager, err := NewPager(f, pageSize, log, opts.WAL, schema)
+	if err != nil {
+		return nil, err
+	}
+	b := &BTree[K, V]{
+		n:       n,
+		log:     log,
+		dbg:     opts.Validate,
+		pager:   pager,
+		pool:    NewBufferPool(pager, frames, opts.Policy),
+		compare: schema.Compare,
+		blink:   opts.BLink,
+	}
+	if id := pager.Root(); id != 0 {
+		root, err := b.pool.Pin(id)
+		if err != nil {
+			return nil, err
+		}
+		b.Root = root
+		if b.blink {
+			b.openLink()
+		}
+		return b, nil
 	}
+	wr := b.writer()
 	x := b.allocate()
 	x.Leaf = true
-	b.write(x)
-	b.Root = x
-	return b
+	wr.write(x)
+	wr.setRoot(x)
+	err = wr.commit()
+	b.unpin(x)
+	if err != nil {
+		return nil, err
+	}
+	return b, nil
 }
 
-func FromString(n int, input string, w io.Writer) *BTree {
+func FromString(n int, input string, w io.Writer) *BTree[int, PageID] {
 	T := New(n, w)
+	empty := T.Root
 
-	var stack []*Node
-	top := func() *Node {
+	var stack []*Node[int, PageID]
+	top := func() *Node[int, PageID] {
 		if len(stack) == 0 {
 			return nil
 		}
 		return stack[len(stack)-1]
 	}
-	var root *Node
+	var root *Node[int, PageID]
 	pop := func() {
 		if len(stack) == 0 {
 			panic("FromString: invalid input: too many parantheses")
@@ -48,11 +134,14 @@ func FromString(n int, input string, w io.Writer) *BTree {
 		return int(c)
 	}
 
+	// the nodes are built in memory, and written once they're complete
+	nodes := make(map[PageID]*Node[int, PageID])
 	for _, c := range input {
 		switch c {
 		case '(':
-			tmp := T.pageCache.Allocate()
+			tmp := T.allocate()
 			tmp.Leaf = true
+			nodes[tmp.PageID] = tmp
 			parent := top()
 			if parent != nil {
 				parent.Leaf = false
@@ -71,11 +160,10 @@ func FromString(n int, input string, w io.Writer) *BTree {
 		panic("FromString: invalid input: unclosed parantheses")
 	}
 
-	T.Root = root
-
 	// Add next child
-	var prev *Node
-	T.WalkNodes(T.Root, func(n *Node) {
+	var prev *Node[int, PageID]
+	var walk func(n *Node[int, PageID])
+	walk = func(n *Node[int, PageID]) {
 		if n.Leaf {
 			pointers := make([]PageID, len(n.Keys))
 			n.Values = pointers
@@ -86,9 +174,43 @@ func FromString(n int, input string, w io.Writer) *BTree {
 			}
 			prev = n
 		}
-	})
+		for _, id := range n.Children {
+			walk(nodes[id])
+		}
+	}
+	walk(root)
 
+	wr := T.writer()
+	for _, n := range nodes {
+		wr.write(n)
+	}
+	wr.setRoot(root)
+	if err := wr.commit(); err != nil {
+		panic(err)
+	}
+	for _, n := range nodes {
+		T.unpin(n)
+	}
+	T.free(empty)
+	if err := wr.commit(); err != nil {
+		panic(err)
+	}
+
+	T.sparse = true
 	T.validate()
 
 	return T
 }
+
+// maxKeys is the number of keys that always fit in a node. A leaf cell is at
+// most keylen, valuelen, key and value, and each cell needs a 2 byte offset.
+// Page header and cell count is 15. Without an upper bound on the size of
+// keys and values, it's up to the caller, and maxKeys returns 0.
+func maxKeys[K, V any](pageSize int, schema Schema[K, V]) int {
+	k, v := schema.Key.MaxSize(), schema.Value.MaxSize()
+	if k == 0 || v == 0 {
+		return 0
+	}
+	lengths := binary.AppendUvarint(binary.AppendUvarint(nil, uint64(k)), uint64(v))
+	return (pageSize - 15) / (len(lengths) + k + v + 2)
+}
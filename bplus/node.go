@@ -2,22 +2,29 @@ package bplus
 
 import "strings"
 
-type Node struct {
+type Node[K, V any] struct {
 	PageID
-	Keys []int
+	Keys []K
 	Leaf bool
 
 	RightSibling *PageID
 
+	// HighKey bounds the keys in and below a node of a B-link tree, and is
+	// nil for the rightmost node on a level. Internal nodes of a B-link tree
+	// have a RightSibling too. See blink.go.
+	HighKey *K
+
+	LSN uint64 // lsn of the last logged change; see Pager.Commit
+
 	// leaf: has N-1 keys and N pointers
 	// For leaf, the last pointer points to sibling node (next) - not back
 	Children []PageID // child nodes
-	Values   []PageID // things we point to
+	Values   []V      // things we point to
 }
 
-func (n *Node) median() (index int, key int) {
+func (n *Node[K, V]) median() (index int, key K) {
 	if len(n.Keys) == 0 {
-		return 0, 0
+		return 0, key
 	}
 
 	index = len(n.Keys) / 2
@@ -25,14 +32,14 @@ func (n *Node) median() (index int, key int) {
 	return
 }
 
-func (n *Node) MinKey() int {
+func (n *Node[K, V]) MinKey() K {
 	if len(n.Keys) == 0 {
 		panic("FirstKey: Node has no keys")
 	}
 	return n.Keys[0]
 }
 
-func (n *Node) String() string {
+func (n *Node[K, V]) String() string {
 	if n == nil {
 		return "nil"
 	}
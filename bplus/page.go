@@ -1,60 +1,14 @@
 package bplus
 
-import (
-	"fmt"
-	"log/slog"
-)
-
 type PageID int
 
-type statistics struct {
-	Reads  int
-	Writes int
-}
+// Stats counts the work done by a pager and its buffer pool
+type Stats struct {
+	Reads  int // nodes read from the file
+	Writes int // nodes written to the file
 
-type PageCache struct {
-	log   *slog.Logger
-	nodes []*Node
-	stats statistics
-}
-
-func NewPageCache(log *slog.Logger) *PageCache {
-	return &PageCache{
-		log:   log,
-		nodes: nil,
-	}
-}
-
-func (pc *PageCache) Read(id PageID) *Node {
-	for _, node := range pc.nodes {
-		if node.PageID == id {
-			pc.stats.Reads++
-			return node
-		}
-	}
-	panic(fmt.Sprintf("PageCache.Read: no node found with id %d", id))
-}
-
-func (pc *PageCache) Write(n *Node) *Node {
-	_, med := n.median()
-	pc.log.Debug("Disk write", "node", keyString(med))
-	var found bool
-	for _, node := range pc.nodes {
-		if node == n {
-			found = true
-		}
-	}
-	if !found {
-		pc.nodes = append(pc.nodes, n)
-	}
-	pc.stats.Writes++
-	return n
-}
-func (pc *PageCache) Allocate() *Node {
-	pc.log.Debug("Allocate-Node")
-	n := &Node{
-		PageID: PageID(len(pc.nodes)),
-	}
-	pc.nodes = append(pc.nodes, n)
-	return n
+	// buffer pool
+	Hits      int
+	Misses    int
+	Evictions int
 }
@@ -0,0 +1,661 @@
+package bplus
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"math"
+	"slices"
+	"sync"
+
+	"github.com/kvalv/algos/page"
+)
+
+// The file is a sequence of fixed-size pages. Page 0 is the meta page, so a
+// PageID of 0 never refers to a node and doubles as "no page". The meta page
+// looks like this:
+//
+//	| magic | page size | root | free list head | number of pages | lsn |
+//
+// Freed pages form a linked list; the first two bytes of a free page is the
+// id of the next free page.
+//
+// Nodes are written when they're evicted from the buffer pool, but changes to
+// the meta page and the free list are held back until Commit. With a WAL,
+// Commit logs the images of every page changed by the operation before any
+// of them reach the file, so an operation is either redone or not visible.
+
+const (
+	DefaultPageSize = 4096
+	metaPage        = PageID(0)
+	pagerMagic      = "bpl+"
+)
+
+var ErrBadMagic = errors.New("not a bplus file")
+
+// File is where the pager keeps its pages, e.g. an *os.File
+type File interface {
+	io.ReaderAt
+	io.WriterAt
+}
+
+// Pager is safe for concurrent use
+type Pager[K, V any] struct {
+	mu       sync.Mutex
+	log      *slog.Logger
+	schema   Schema[K, V]
+	file     File
+	pageSize int
+	root     PageID
+	freeHead PageID
+	numPages int // including the meta page
+
+	// stats is updated by the pager and the buffer pool, under their own
+	// locks, so it has a lock of its own
+	statsMu sync.Mutex
+	stats   Stats
+
+	wal       *WAL   // nil if changes are not logged
+	lsn       uint64 // last lsn handed out
+	metaDirty bool
+	pending   map[PageID][]byte   // free pages not yet committed
+	overflow  map[PageID][]PageID // overflow pages of each node, as last encoded or read
+}
+
+// NewPager opens the pager on f. An empty file is initialized with a fresh
+// meta page; otherwise the meta page is read and checked. If wal is non-nil,
+// committed operations in it are redone before the pager is returned. Nodes
+// are encoded with the schema's codecs.
+func NewPager[K, V any](f File, pageSize int, log *slog.Logger, wal LogFile, schema Schema[K, V]) (*Pager[K, V], error) {
+	if pageSize < 64 || pageSize > math.MaxUint16 {
+		return nil, fmt.Errorf("pager: invalid page size %d", pageSize)
+	}
+	pg := &Pager[K, V]{
+		log:      log,
+		schema:   schema,
+		file:     f,
+		pageSize: pageSize,
+		numPages: 1,
+		pending:  make(map[PageID][]byte),
+		overflow: make(map[PageID][]PageID),
+	}
+	if wal != nil {
+		pg.wal = NewWAL(wal)
+		if err := pg.recover(); err != nil {
+			return nil, err
+		}
+	}
+	b := make([]byte, pageSize)
+	n, err := f.ReadAt(b, 0)
+	if n == 0 && (err == nil || errors.Is(err, io.EOF)) {
+		return pg, pg.writePage(metaPage, pg.metaBytes())
+	}
+	if n < pageSize {
+		return nil, fmt.Errorf("pager: short meta page: %w", err)
+	}
+	if string(b[0:4]) != pagerMagic {
+		return nil, ErrBadMagic
+	}
+	if size := int(binary.BigEndian.Uint16(b[4:6])); size != pageSize {
+		return nil, fmt.Errorf("pager: file has page size %d, want %d", size, pageSize)
+	}
+	pg.root = PageID(binary.BigEndian.Uint16(b[6:8]))
+	pg.freeHead = PageID(binary.BigEndian.Uint16(b[8:10]))
+	pg.numPages = int(binary.BigEndian.Uint32(b[10:14]))
+	pg.lsn = max(pg.lsn, binary.BigEndian.Uint64(b[14:22]))
+	return pg, nil
+}
+
+func (pg *Pager[K, V]) metaBytes() []byte {
+	b := make([]byte, pg.pageSize)
+	copy(b[0:4], pagerMagic)
+	binary.BigEndian.PutUint16(b[4:6], uint16(pg.pageSize))
+	binary.BigEndian.PutUint16(b[6:8], uint16(pg.root))
+	binary.BigEndian.PutUint16(b[8:10], uint16(pg.freeHead))
+	binary.BigEndian.PutUint32(b[10:14], uint32(pg.numPages))
+	binary.BigEndian.PutUint64(b[14:22], pg.lsn)
+	return b
+}
+
+// recover redoes every committed operation in the log. Node and meta pages
+// that already have a newer lsn on disk are skipped.
+func (pg *Pager[K, V]) recover() error {
+	records, err := pg.wal.Records()
+	if err != nil {
+		return err
+	}
+	for _, r := range records {
+		pg.lsn = max(pg.lsn, r.lsn)
+	}
+	redone := committed(records)
+	for _, r := range redone {
+		if len(r.image) != pg.pageSize {
+			return fmt.Errorf("pager: recover: image of page %d has %d bytes", r.page, len(r.image))
+		}
+		if lsn, ok := pg.diskLSN(r); ok && lsn >= r.lsn {
+			continue
+		}
+		if err := pg.writePage(r.page, r.image); err != nil {
+			return err
+		}
+	}
+	pg.log.Debug("Recovered", "records", len(records), "redone", len(redone))
+	if err := pg.sync(); err != nil {
+		return err
+	}
+	return pg.wal.Reset()
+}
+
+// diskLSN returns the lsn of the page of r as it is in the file, if it has
+// one. Only the meta page and node pages do; any other page, such as an
+// overflow or free page, is always redone, since its bytes may well decode as
+// a node page.
+func (pg *Pager[K, V]) diskLSN(r walRecord) (uint64, bool) {
+	id := r.page
+	if id != metaPage && r.typ != recordNode {
+		return 0, false
+	}
+	b := make([]byte, pg.pageSize)
+	if n, _ := pg.file.ReadAt(b, int64(id)*int64(pg.pageSize)); n < pg.pageSize {
+		return 0, false
+	}
+	if id == metaPage {
+		if string(b[0:4]) != pagerMagic {
+			return 0, false
+		}
+		return binary.BigEndian.Uint64(b[14:22]), true
+	}
+	p, err := page.Decode(b)
+	if err != nil {
+		return 0, false
+	}
+	return p.Header.LSN, true
+}
+
+func (pg *Pager[K, V]) readPage(id PageID, b []byte) error {
+	if id <= metaPage || int(id) >= pg.numPages {
+		return fmt.Errorf("pager: page %d out of range", id)
+	}
+	if p, ok := pg.pending[id]; ok {
+		copy(b, p)
+		return nil
+	}
+	if _, err := pg.file.ReadAt(b, int64(id)*int64(pg.pageSize)); err != nil {
+		return fmt.Errorf("pager: read page %d: %w", id, err)
+	}
+	return nil
+}
+
+func (pg *Pager[K, V]) writePage(id PageID, b []byte) error {
+	if _, err := pg.file.WriteAt(b, int64(id)*int64(pg.pageSize)); err != nil {
+		return fmt.Errorf("pager: write page %d: %w", id, err)
+	}
+	return nil
+}
+
+func (pg *Pager[K, V]) sync() error {
+	if s, ok := pg.file.(interface{ Sync() error }); ok {
+		return s.Sync()
+	}
+	return nil
+}
+
+// Root is the page id of the root node, or 0 if the tree is empty
+func (pg *Pager[K, V]) Root() PageID {
+	pg.mu.Lock()
+	defer pg.mu.Unlock()
+	return pg.root
+}
+
+// Stats returns a snapshot of the counters of the pager and its buffer pool
+func (pg *Pager[K, V]) Stats() Stats {
+	pg.statsMu.Lock()
+	defer pg.statsMu.Unlock()
+	return pg.stats
+}
+
+// count updates the counters with f
+func (pg *Pager[K, V]) count(f func(s *Stats)) {
+	pg.statsMu.Lock()
+	defer pg.statsMu.Unlock()
+	f(&pg.stats)
+}
+
+func (pg *Pager[K, V]) Read(id PageID) (*Node[K, V], error) {
+	pg.mu.Lock()
+	defer pg.mu.Unlock()
+	b := make([]byte, pg.pageSize)
+	if err := pg.readPage(id, b); err != nil {
+		return nil, err
+	}
+	pg.count(func(s *Stats) { s.Reads++ })
+	return pg.decodeNode(id, b)
+}
+
+func (pg *Pager[K, V]) Write(n *Node[K, V]) error {
+	pg.mu.Lock()
+	defer pg.mu.Unlock()
+	_, med := n.median()
+	pg.log.Debug("Disk write", "node", keyString(med))
+	b, overflow, err := pg.encodeNode(n)
+	if err != nil {
+		return err
+	}
+	for _, id := range slices.Sorted(maps.Keys(overflow)) {
+		if err := pg.writePage(id, overflow[id]); err != nil {
+			return err
+		}
+	}
+	if err := pg.writePage(n.PageID, b); err != nil {
+		return err
+	}
+	pg.count(func(s *Stats) { s.Writes++ })
+	if pg.wal == nil {
+		// overflow pages may have been allocated or freed. Without a log
+		// there's no commit to wait for, so the free list is written now.
+		return pg.writePending()
+	}
+	return nil
+}
+
+// Allocate hands out a new, empty node; from the free list if possible. The
+// node is not written until Write is called.
+func (pg *Pager[K, V]) Allocate() (*Node[K, V], error) {
+	pg.mu.Lock()
+	defer pg.mu.Unlock()
+	pg.log.Debug("Allocate-Node")
+	id, err := pg.allocate()
+	if err != nil {
+		return nil, err
+	}
+	return &Node[K, V]{PageID: id}, nil
+}
+
+// allocate hands out a page; pg.mu must be held
+func (pg *Pager[K, V]) allocate() (PageID, error) {
+	id := pg.freeHead
+	if id != 0 {
+		b := make([]byte, pg.pageSize)
+		if err := pg.readPage(id, b); err != nil {
+			return 0, err
+		}
+		pg.freeHead = PageID(binary.BigEndian.Uint16(b[0:2]))
+		delete(pg.pending, id)
+	} else {
+		if pg.numPages > math.MaxUint16 {
+			return 0, fmt.Errorf("pager: no more page ids")
+		}
+		id = PageID(pg.numPages)
+		pg.numPages++
+	}
+	pg.metaDirty = true
+	return id, nil
+}
+
+// Free puts the page of a node, and its overflow pages, on the free list, so
+// they can be handed out again
+func (pg *Pager[K, V]) Free(id PageID) error {
+	pg.mu.Lock()
+	defer pg.mu.Unlock()
+	pg.log.Debug("Free-Node", "page", id)
+	for _, o := range pg.overflow[id] {
+		if err := pg.free(o); err != nil {
+			return err
+		}
+	}
+	delete(pg.overflow, id)
+	return pg.free(id)
+}
+
+// free puts the page on the free list; pg.mu must be held
+func (pg *Pager[K, V]) free(id PageID) error {
+	if id <= metaPage || int(id) >= pg.numPages {
+		return fmt.Errorf("pager: page %d out of range", id)
+	}
+	b := make([]byte, pg.pageSize)
+	binary.BigEndian.PutUint16(b[0:2], uint16(pg.freeHead))
+	pg.pending[id] = b
+	pg.freeHead = id
+	pg.metaDirty = true
+	return nil
+}
+
+// Commit ends an operation that changed the given nodes, and made root the
+// root node, unless it's 0. With a WAL, the node images, the free pages and
+// the meta page are logged and synced, and the nodes are stamped with their
+// lsn. The nodes themselves are written later, by the buffer pool.
+//
+// Free pages and allocations of operations that are still running may be
+// committed along with this one. The root is only changed here, so it never
+// points to a node before the node is logged.
+func (pg *Pager[K, V]) Commit(nodes []*Node[K, V], root PageID) error {
+	pg.mu.Lock()
+	defer pg.mu.Unlock()
+	if root != 0 && root != pg.root {
+		pg.root = root
+		pg.metaDirty = true
+	}
+	if len(nodes) == 0 && len(pg.pending) == 0 && !pg.metaDirty {
+		return nil
+	}
+	written := make(map[PageID][]byte)
+	if pg.wal != nil {
+		for _, n := range nodes {
+			pg.lsn++
+			n.LSN = pg.lsn
+			b, overflow, err := pg.encodeNode(n)
+			if err != nil {
+				return err
+			}
+			if err := pg.wal.Append(walRecord{typ: recordNode, lsn: n.LSN, page: n.PageID, image: b}); err != nil {
+				return err
+			}
+			// the node is written by the buffer pool, but its overflow pages
+			// go with the free pages
+			for id, b := range overflow {
+				pg.lsn++
+				if err := pg.wal.Append(walRecord{typ: recordPage, lsn: pg.lsn, page: id, image: b}); err != nil {
+					return err
+				}
+				written[id] = b
+			}
+		}
+		for _, id := range slices.Sorted(maps.Keys(pg.pending)) {
+			pg.lsn++
+			if err := pg.wal.Append(walRecord{typ: recordPage, lsn: pg.lsn, page: id, image: pg.pending[id]}); err != nil {
+				return err
+			}
+		}
+		if pg.metaDirty {
+			pg.lsn++
+			if err := pg.wal.Append(walRecord{typ: recordPage, lsn: pg.lsn, page: metaPage, image: pg.metaBytes()}); err != nil {
+				return err
+			}
+		}
+		pg.lsn++
+		if err := pg.wal.Append(walRecord{typ: recordCommit, lsn: pg.lsn}); err != nil {
+			return err
+		}
+		if err := pg.wal.Sync(); err != nil {
+			return err
+		}
+	}
+	for id, b := range written {
+		if err := pg.writePage(id, b); err != nil {
+			return err
+		}
+	}
+	return pg.writePending()
+}
+
+// writePending writes the free pages and the meta page; pg.mu must be held
+func (pg *Pager[K, V]) writePending() error {
+	for id, b := range pg.pending {
+		if err := pg.writePage(id, b); err != nil {
+			return err
+		}
+		delete(pg.pending, id)
+	}
+	if pg.metaDirty {
+		if err := pg.writePage(metaPage, pg.metaBytes()); err != nil {
+			return err
+		}
+		pg.metaDirty = false
+	}
+	return nil
+}
+
+// Checkpoint makes the file self-contained, so the log can be emptied. All
+// nodes must have been written, and all operations committed.
+func (pg *Pager[K, V]) Checkpoint() error {
+	pg.mu.Lock()
+	defer pg.mu.Unlock()
+	if len(pg.pending) > 0 || pg.metaDirty {
+		return fmt.Errorf("pager: checkpoint with uncommitted changes")
+	}
+	if err := pg.writePage(metaPage, pg.metaBytes()); err != nil {
+		return err
+	}
+	if err := pg.sync(); err != nil {
+		return err
+	}
+	if pg.wal == nil {
+		return nil
+	}
+	return pg.wal.Reset()
+}
+
+// memFile is an in-memory File, used when the tree is not backed by disk
+type memFile struct {
+	b []byte
+}
+
+func (m *memFile) ReadAt(p []byte, off int64) (int, error) {
+	if off >= int64(len(m.b)) {
+		return 0, io.EOF
+	}
+	n := copy(p, m.b[off:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (m *memFile) Truncate(size int64) error {
+	m.b = m.b[:size]
+	return nil
+}
+
+func (m *memFile) Sync() error { return nil }
+
+func (m *memFile) WriteAt(p []byte, off int64) (int, error) {
+	if end := int(off) + len(p); end > len(m.b) {
+		m.b = append(m.b, make([]byte, end-len(m.b))...)
+	}
+	return copy(m.b[off:], p), nil
+}
+
+// Nodes are stored as slotted pages. Leaves use value cells, internal nodes
+// use key cells where cell i points to the child left of key i. The page's
+// right pointer is the right sibling of a leaf, or the rightmost child of an
+// internal node. Nodes with a high key store it in the page header, along
+// with their right sibling as the link.
+//
+// Values too large for a page spill to overflow pages; see page.Spill. A node
+// reuses its overflow pages, in order, each time it's encoded, so encoding it
+// again gives the same pages.
+
+// overflowStore is the page.Store of the overflow pages of a node. pg.mu must
+// be held while it's used.
+type overflowStore[K, V any] struct {
+	pg     *Pager[K, V]
+	owned  []PageID // pages the node had
+	reuse  []PageID // of those, the ones not used yet
+	used   []PageID
+	images map[PageID][]byte // written pages
+}
+
+func (s *overflowStore[K, V]) Allocate() (page.PageID, error) {
+	var id PageID
+	if len(s.reuse) > 0 {
+		id, s.reuse = s.reuse[0], s.reuse[1:]
+	} else {
+		var err error
+		if id, err = s.pg.allocate(); err != nil {
+			return 0, err
+		}
+	}
+	s.used = append(s.used, id)
+	return page.PageID(id), nil
+}
+
+// Free gives back a page that was written, when a spill fails. The node's own
+// pages are kept for reuse.
+func (s *overflowStore[K, V]) Free(id page.PageID) error {
+	pid := PageID(id)
+	delete(s.images, pid)
+	if i := slices.Index(s.used, pid); i >= 0 {
+		s.used = slices.Delete(s.used, i, i+1)
+	}
+	if slices.Contains(s.owned, pid) {
+		s.reuse = append(s.reuse, pid)
+		return nil
+	}
+	return s.pg.free(pid)
+}
+
+func (s *overflowStore[K, V]) ReadPage(id page.PageID) ([]byte, error) {
+	if b, ok := s.images[PageID(id)]; ok {
+		return b, nil
+	}
+	s.used = append(s.used, PageID(id))
+	b := make([]byte, s.pg.pageSize)
+	return b, s.pg.readPage(PageID(id), b)
+}
+
+func (s *overflowStore[K, V]) WritePage(id page.PageID, b []byte) error {
+	s.images[PageID(id)] = b
+	return nil
+}
+
+// encodeNode returns the page of the node, and the overflow pages it uses
+func (pg *Pager[K, V]) encodeNode(n *Node[K, V]) ([]byte, map[PageID][]byte, error) {
+	owned := pg.overflow[n.PageID]
+	store := &overflowStore[K, V]{pg: pg, owned: owned, reuse: slices.Clone(owned), images: make(map[PageID][]byte)}
+	b, err := pg.encodePage(n, store)
+	if err != nil {
+		// give back the pages that weren't the node's
+		for _, id := range store.used {
+			if !slices.Contains(owned, id) {
+				pg.free(id)
+			}
+		}
+		return nil, nil, err
+	}
+	for _, id := range store.reuse {
+		if err := pg.free(id); err != nil {
+			return nil, nil, err
+		}
+	}
+	if len(store.used) > 0 {
+		pg.overflow[n.PageID] = store.used
+	} else {
+		delete(pg.overflow, n.PageID)
+	}
+	return b, store.images, nil
+}
+
+func (pg *Pager[K, V]) encodePage(n *Node[K, V], store page.Store) ([]byte, error) {
+	p, err := page.NewPage(pg.pageSize)
+	if err != nil {
+		return nil, err
+	}
+	p.Header.LSN = n.LSN
+	if n.HighKey != nil {
+		if n.RightSibling == nil {
+			return nil, fmt.Errorf("encode node %d: high key without a right sibling", n.PageID)
+		}
+		p.Header.Link = page.PageID(*n.RightSibling)
+		p.Header.HighKey = string(pg.schema.Key.Append(nil, *n.HighKey))
+	}
+	if n.Leaf {
+		p.Header.CType = page.CellTypeValue
+		if n.RightSibling != nil {
+			p.Header.Right = page.PageID(*n.RightSibling)
+		}
+		for i, k := range n.Keys {
+			key := string(pg.schema.Key.Append(nil, k))
+			value := pg.schema.Value.Append(nil, n.Values[i])
+			c, err := page.Spill(store, page.NewValueCell(key, value), pg.pageSize)
+			if err != nil {
+				return nil, fmt.Errorf("encode node %d: key %s: %w", n.PageID, keyString(k), err)
+			}
+			if _, err := p.Insert(c); err != nil {
+				return nil, fmt.Errorf("encode node %d: key %s: %w", n.PageID, keyString(k), err)
+			}
+		}
+	} else {
+		if len(n.Children) != len(n.Keys)+1 {
+			return nil, fmt.Errorf("encode node %d: %d keys but %d children", n.PageID, len(n.Keys), len(n.Children))
+		}
+		p.Header.CType = page.CellTypeKey
+		p.Header.Right = page.PageID(n.Children[len(n.Keys)])
+		for i, k := range n.Keys {
+			key := string(pg.schema.Key.Append(nil, k))
+			if _, err := p.Insert(page.NewKeyCell(key, page.PageID(n.Children[i]))); err != nil {
+				return nil, fmt.Errorf("encode node %d: key %s: %w", n.PageID, keyString(k), err)
+			}
+		}
+	}
+	b := make([]byte, pg.pageSize)
+	if _, err := p.Write(b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// decodeNode reads a node written by encodeNode. The page orders cells by
+// their encoded keys, so they're sorted again by the schema's order.
+func (pg *Pager[K, V]) decodeNode(id PageID, b []byte) (*Node[K, V], error) {
+	p, err := page.Decode(b)
+	if err != nil {
+		return nil, fmt.Errorf("decode node %d: %w", id, err)
+	}
+	n := &Node[K, V]{PageID: id, Leaf: p.Header.CType == page.CellTypeValue, LSN: p.Header.LSN}
+	store := &overflowStore[K, V]{pg: pg}
+	type entry struct {
+		key   K
+		value V
+		child PageID
+	}
+	entries := make([]entry, len(p.Cells))
+	for i, c := range p.Cells {
+		k, err := pg.schema.Key.Decode([]byte(c.Key))
+		if err != nil {
+			return nil, fmt.Errorf("decode node %d: %w", id, err)
+		}
+		entries[i] = entry{key: k, child: PageID(c.PageID)}
+		if n.Leaf {
+			if c, err = page.Assemble(store, c); err != nil {
+				return nil, fmt.Errorf("decode node %d: key %s: %w", id, keyString(k), err)
+			}
+			if entries[i].value, err = pg.schema.Value.Decode(c.Value); err != nil {
+				return nil, fmt.Errorf("decode node %d: key %s: %w", id, keyString(k), err)
+			}
+		}
+	}
+	if len(store.used) > 0 {
+		pg.overflow[id] = store.used
+	} else {
+		delete(pg.overflow, id)
+	}
+	slices.SortFunc(entries, func(a, b entry) int { return pg.schema.Compare(a.key, b.key) })
+	for _, e := range entries {
+		n.Keys = append(n.Keys, e.key)
+		if n.Leaf {
+			n.Values = append(n.Values, e.value)
+		} else {
+			n.Children = append(n.Children, e.child)
+		}
+	}
+	if n.Leaf {
+		if p.Header.Right != 0 {
+			tmp := PageID(p.Header.Right)
+			n.RightSibling = &tmp
+		}
+	} else {
+		n.Children = append(n.Children, PageID(p.Header.Right))
+	}
+	if p.Header.Link != 0 {
+		k, err := pg.schema.Key.Decode([]byte(p.Header.HighKey))
+		if err != nil {
+			return nil, fmt.Errorf("decode node %d: high key: %w", id, err)
+		}
+		link := PageID(p.Header.Link)
+		n.HighKey, n.RightSibling = &k, &link
+	}
+	return n, nil
+}
@@ -0,0 +1,200 @@
+package bplus
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestOpen(t *testing.T) {
+	fname := filepath.Join(t.TempDir(), "tree.db")
+	f, err := os.Create(fname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree, err := Open(3, f, Options{PageSize: 256, Validate: true}, io.Discard)
+	if err != nil {
+		t.Fatalf("failed to open: %s", err)
+	}
+	keys := rand.New(rand.NewSource(1)).Perm(200)
+	for _, k := range keys {
+		tree.Insert(k, PageID(k*2))
+	}
+	want := tree.String(tree.Root)
+	if err := tree.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err = os.OpenFile(fname, os.O_RDWR, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	reopened, err := Open(3, f, Options{PageSize: 256}, io.Discard)
+	if err != nil {
+		t.Fatalf("failed to reopen: %s", err)
+	}
+	expectTree(t, want, reopened)
+	slices.Sort(keys)
+	var got []int
+	it := reopened.Range(math.MinInt, math.MaxInt)
+	for m := it.Next(); m != nil; m = it.Next() {
+		got = append(got, m.Node.Keys[m.Index])
+	}
+	if !slices.Equal(got, keys) {
+		t.Fatalf("keys mismatch;\nwant= %v\ngot = %v", keys, got)
+	}
+	m := reopened.Find(42)
+	if m == nil || m.Node.Values[m.Index] != 84 {
+		t.Fatalf("expected to find 42 with value 84, got %s", m)
+	}
+
+	if _, err := Open(3, f, Options{PageSize: 512}, io.Discard); err == nil {
+		t.Fatalf("expected page size mismatch")
+	}
+	if _, err := Open(3, &memFile{b: make([]byte, 256)}, Options{PageSize: 256}, io.Discard); !errors.Is(err, ErrBadMagic) {
+		t.Fatalf("want ErrBadMagic, got %v", err)
+	}
+}
+
+func TestPagerFreeList(t *testing.T) {
+	pg, err := NewPager(&memFile{}, 128, NewLogger(io.Discard), nil, IntSchema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, _ := pg.Allocate()
+	b, _ := pg.Allocate()
+	if a.PageID != 1 || b.PageID != 2 {
+		t.Fatalf("expected pages 1 and 2, got %d and %d", a.PageID, b.PageID)
+	}
+	if err := pg.Free(a.PageID); err != nil {
+		t.Fatal(err)
+	}
+	if err := pg.Free(b.PageID); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []PageID{2, 1, 3} {
+		got, err := pg.Allocate()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.PageID != want {
+			t.Fatalf("want page %d, got %d", want, got.PageID)
+		}
+	}
+	if _, err := pg.Read(0); err == nil {
+		t.Fatalf("expected error reading the meta page")
+	}
+}
+
+func TestStatistics(t *testing.T) {
+	tree := FromString(3, "(5(3(12)(34))(7(56)(78)))", io.Discard)
+	if err := tree.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	before := tree.Stats()
+	tree.Find(6)
+	// root, one internal node and one leaf; all in the buffer pool
+	if got := tree.Stats().Hits - before.Hits; got != 3 {
+		t.Fatalf("want 3 hits, got %d", got)
+	}
+	if got := tree.Stats().Reads - before.Reads; got != 0 {
+		t.Fatalf("want 0 reads, got %d", got)
+	}
+
+	before = tree.Stats()
+	tree.Insert(9, 0) // no split
+	if got := tree.Stats().Writes - before.Writes; got != 0 {
+		t.Fatalf("want 0 writes before flush, got %d", got)
+	}
+	if err := tree.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if got := tree.Stats().Writes - before.Writes; got != 1 {
+		t.Fatalf("want 1 write, got %d", got)
+	}
+}
+
+// Values larger than a page spill to overflow pages, and are read back whole
+func TestOverflow(t *testing.T) {
+	schema := StringSchema[string](StringCodec{})
+	insert := func(t *testing.T, tree *BTree[string, string]) map[string]string {
+		rng := rand.New(rand.NewSource(1))
+		want := map[string]string{}
+		for i := range 60 {
+			key := fmt.Sprintf("key%02d", i)
+			value := strings.Repeat(string(rune('a'+i%26)), []int{10, 100, 1000}[rng.Intn(3)])
+			tree.Insert(key, value)
+			want[key] = value
+		}
+		for i := range 20 {
+			key := fmt.Sprintf("key%02d", 3*i)
+			tree.Delete(key)
+			delete(want, key)
+		}
+		return want
+	}
+	expect := func(t *testing.T, tree *BTree[string, string], want map[string]string) {
+		for key, value := range want {
+			m := tree.Find(key)
+			if m == nil || m.Node.Values[m.Index] != value {
+				t.Fatalf("Find(%q) = %v; want a value of %d bytes", key, m, len(value))
+			}
+		}
+	}
+
+	t.Run("flush", func(t *testing.T) {
+		f, err := os.Create(filepath.Join(t.TempDir(), "tree.db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		opts := Options{PageSize: 256, Frames: 20}
+		tree, err := OpenWith(2, f, schema, opts, io.Discard)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := insert(t, tree)
+		if err := tree.Flush(); err != nil {
+			t.Fatal(err)
+		}
+		// encoding the nodes again reuses their overflow pages
+		pages := tree.pager.numPages
+		if err := tree.Flush(); err != nil {
+			t.Fatal(err)
+		}
+		if tree.pager.numPages != pages {
+			t.Errorf("flushing again grew the file from %d to %d pages", pages, tree.pager.numPages)
+		}
+		reopened, err := OpenWith(2, f, schema, opts, io.Discard)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expect(t, reopened, want)
+	})
+
+	t.Run("recovery", func(t *testing.T) {
+		data, log := &memFile{}, &memFile{}
+		opts := Options{PageSize: 256, Frames: 20, WAL: log}
+		tree, err := OpenWith(2, data, schema, opts, io.Discard)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := insert(t, tree)
+		reopened, err := OpenWith(2, data, schema, opts, io.Discard)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expect(t, reopened, want)
+	})
+}
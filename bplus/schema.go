@@ -0,0 +1,88 @@
+package bplus
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/binary"
+	"fmt"
+)
+
+// Schema describes the keys and values of a tree. Keys are ordered by
+// Compare, which returns a negative number if a < b, zero if they're equal,
+// and a positive number if a > b. Keys that compare equal must encode to the
+// same bytes.
+type Schema[K, V any] struct {
+	Compare func(a, b K) int
+	Key     Codec[K]
+	Value   Codec[V]
+}
+
+// Codec converts keys or values to and from bytes. The encoding need not
+// preserve order; nodes are sorted with Schema.Compare when they're read.
+type Codec[T any] interface {
+	Append(b []byte, v T) []byte
+	Decode(b []byte) (T, error)
+
+	// MaxSize is an upper bound on the size of an encoded value, or 0 if
+	// there is none
+	MaxSize() int
+}
+
+// IntSchema is the schema of trees returned by New, Open and FromString
+var IntSchema = Schema[int, PageID]{
+	Compare: cmp.Compare[int],
+	Key:     IntCodec{},
+	Value:   PageIDCodec{},
+}
+
+// StringSchema has string keys, and is ordered like strings.Compare
+func StringSchema[V any](values Codec[V]) Schema[string, V] {
+	return Schema[string, V]{Compare: cmp.Compare[string], Key: StringCodec{}, Value: values}
+}
+
+// BytesSchema has byte slice keys, and is ordered like bytes.Compare
+func BytesSchema[V any](values Codec[V]) Schema[[]byte, V] {
+	return Schema[[]byte, V]{Compare: bytes.Compare, Key: BytesCodec{}, Value: values}
+}
+
+// IntCodec stores an int big-endian with the sign bit flipped, so the byte
+// order of encoded ints matches their numeric order
+type IntCodec struct{}
+
+func (IntCodec) Append(b []byte, v int) []byte {
+	return binary.BigEndian.AppendUint64(b, uint64(v)^(1<<63))
+}
+func (IntCodec) Decode(b []byte) (int, error) {
+	if len(b) != 8 {
+		return 0, fmt.Errorf("int: bad length %d", len(b))
+	}
+	return int(binary.BigEndian.Uint64(b) ^ (1 << 63)), nil
+}
+func (IntCodec) MaxSize() int { return 8 }
+
+// PageIDCodec stores a PageID as a varint
+type PageIDCodec struct{}
+
+func (PageIDCodec) Append(b []byte, v PageID) []byte {
+	return binary.AppendVarint(b, int64(v))
+}
+func (PageIDCodec) Decode(b []byte) (PageID, error) {
+	v, n := binary.Varint(b)
+	if n <= 0 || n != len(b) {
+		return 0, fmt.Errorf("page id: bad varint")
+	}
+	return PageID(v), nil
+}
+func (PageIDCodec) MaxSize() int { return binary.MaxVarintLen64 }
+
+type StringCodec struct{}
+
+func (StringCodec) Append(b []byte, v string) []byte { return append(b, v...) }
+func (StringCodec) Decode(b []byte) (string, error)  { return string(b), nil }
+func (StringCodec) MaxSize() int                     { return 0 }
+
+type BytesCodec struct{}
+
+func (BytesCodec) Append(b []byte, v []byte) []byte { return append(b, v...) }
+func (BytesCodec) Decode(b []byte) ([]byte, error)  { return bytes.Clone(b), nil }
+func (BytesCodec) MaxSize() int                     { return 0 }
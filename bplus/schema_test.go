@@ -0,0 +1,134 @@
+package bplus
+
+import (
+	"cmp"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/rand"
+	"slices"
+	"testing"
+)
+
+func collect[K, V any](T *BTree[K, V], lower, upper K) []K {
+	var res []K
+	it := T.Range(lower, upper)
+	for m := it.Next(); m != nil; m = it.Next() {
+		res = append(res, m.Key())
+	}
+	return res
+}
+
+func TestStringKeys(t *testing.T) {
+	f := &memFile{}
+	opts := Options{PageSize: 256, Frames: 20, Validate: true}
+	tree, err := OpenWith(3, f, StringSchema[int](intValues{}), opts, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var words []string
+	for _, i := range rand.New(rand.NewSource(6)).Perm(100) {
+		w := fmt.Sprintf("w%d", i)
+		words = append(words, w)
+		tree.Insert(w, i)
+	}
+	for _, w := range words[:30] {
+		if !tree.Delete(w) {
+			t.Fatalf("Delete(%q) = false", w)
+		}
+	}
+	if err := tree.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, err := OpenWith(3, f, StringSchema[int](intValues{}), opts, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := slices.Sorted(slices.Values(words[30:]))
+	if got := collect(reopened, "", "x"); !slices.Equal(got, want) {
+		t.Fatalf("keys = %v; want %v", got, want)
+	}
+	m := reopened.Find(words[50])
+	if m == nil || m.Key() != words[50] || fmt.Sprintf("w%d", m.Value()) != words[50] {
+		t.Fatalf("Find(%q) = %v", words[50], m)
+	}
+}
+
+// person is a composite key ordered by age, oldest first, then by name
+type person struct {
+	name string
+	age  int
+}
+
+func comparePeople(a, b person) int {
+	if c := cmp.Compare(b.age, a.age); c != 0 {
+		return c
+	}
+	return cmp.Compare(a.name, b.name)
+}
+
+// personCodec stores the name first, so the byte order is by name
+type personCodec struct{}
+
+func (personCodec) Append(b []byte, p person) []byte {
+	b = binary.AppendUvarint(b, uint64(len(p.name)))
+	b = append(b, p.name...)
+	return binary.AppendVarint(b, int64(p.age))
+}
+func (personCodec) Decode(b []byte) (person, error) {
+	n, m := binary.Uvarint(b)
+	if m <= 0 || m+int(n) > len(b) {
+		return person{}, fmt.Errorf("person: bad name")
+	}
+	age, k := binary.Varint(b[m+int(n):])
+	if k <= 0 {
+		return person{}, fmt.Errorf("person: bad age")
+	}
+	return person{name: string(b[m : m+int(n)]), age: int(age)}, nil
+}
+func (personCodec) MaxSize() int { return 0 }
+
+type intValues struct{}
+
+func (intValues) Append(b []byte, v int) []byte { return binary.AppendVarint(b, int64(v)) }
+func (intValues) Decode(b []byte) (int, error) {
+	v, n := binary.Varint(b)
+	if n <= 0 {
+		return 0, fmt.Errorf("int: bad varint")
+	}
+	return int(v), nil
+}
+func (intValues) MaxSize() int { return binary.MaxVarintLen64 }
+
+func TestCompositeKeys(t *testing.T) {
+	schema := Schema[person, int]{Compare: comparePeople, Key: personCodec{}, Value: intValues{}}
+	f := &memFile{}
+	tree, err := OpenWith(3, f, schema, Options{PageSize: 256, Frames: 20}, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var people []person
+	for i := range 40 {
+		p := person{name: fmt.Sprintf("%c", 'a'+i%26), age: 20 + i%7}
+		people = append(people, p)
+		tree.Insert(p, i)
+	}
+	if err := tree.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the file orders cells by name, but the tree orders them by age
+	reopened, err := OpenWith(3, f, schema, Options{PageSize: 256}, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := reopened.isValid(); err != nil {
+		t.Fatal(err)
+	}
+	slices.SortFunc(people, comparePeople)
+	got := collect(reopened, person{age: 100}, person{age: -1})
+	if !slices.Equal(got, people) {
+		t.Fatalf("keys = %v\nwant %v", got, people)
+	}
+}
@@ -5,20 +5,38 @@ import (
 	"log/slog"
 	"slices"
 	"strings"
+	"sync"
+	"sync/atomic"
 )
 
-type BTree struct {
+// BTree is safe for concurrent use by Insert, Delete, Find, Range, cursors
+// and the iterators; see latch.go. The methods that walk the whole tree, like
+// String, Walk and Flush, are not.
+type BTree[K, V any] struct {
 	// t = n - 1
-	n         int // n pointers, n-1 keys
-	log       *slog.Logger
-	dbg       bool
-	Root      *Node
-	pageCache *PageCache
+	n       int // n pointers, n-1 keys
+	log     *slog.Logger
+	dbg     bool
+	Root    *Node[K, V]
+	pager   *Pager[K, V]
+	pool    *BufferPool[K, V]
+	compare func(a, b K) int
+	version atomic.Uint64 // incremented on every change; see Cursor
+
+	latches   latchTable
+	rootLatch sync.RWMutex // guards Root and height
+
+	blink  bool // see blink.go
+	height int  // of the root in a B-link tree; leaves are at 0
+
+	// sparse trees are exempt from the occupancy and separator checks.
+	// FromString may build trees that Insert and Delete would never leave.
+	sparse bool
 }
 
-func (T *BTree) isValid() error {
+func (T *BTree[K, V]) isValid() error {
 	var err error
-	T.WalkNodes(T.Root, func(n *Node) {
+	T.WalkNodes(T.Root, func(n *Node[K, V]) {
 		if len(n.Keys) > 2*T.n-1 {
 			err = (fmt.Errorf("node %s has %d keys", n, len(n.Keys)))
 		}
@@ -32,40 +50,175 @@ func (T *BTree) isValid() error {
 		if len(n.Children) > 0 && n.Leaf {
 			var childRepr []string
 			for _, id := range n.Children {
-				child := T.pageCache.Read(id)
+				child := T.load(id)
 				childRepr = append(childRepr, child.String())
+				T.unpin(child)
 			}
 			err = (fmt.Errorf("Node %q is a leaf node with %d children; children=%q", n, len(n.Children), strings.Join(childRepr, ", ")))
 		}
 		if len(n.Children) == 0 && !n.Leaf {
 			err = (fmt.Errorf("Node %q is not a leaf, but has children", n))
 		}
+		if !T.sparse && !T.blink && T.underflows(n) {
+			err = fmt.Errorf("node %s has %d keys; want at least %d", n, len(n.Keys), T.minKeys(n))
+		}
 	})
-	return err
+	if err != nil {
+		return err
+	}
+	if !T.sparse {
+		if err := T.checkOrder(T.Root, nil, nil); err != nil {
+			return err
+		}
+	}
+	return T.checkSiblings()
+}
+
+// checkOrder checks that keys are sorted, and that every key in the subtree
+// of n is in [lo, hi). A nil bound is unbounded.
+func (T *BTree[K, V]) checkOrder(n *Node[K, V], lo, hi *K) error {
+	for i, k := range n.Keys {
+		if i > 0 && T.compare(n.Keys[i-1], k) >= 0 {
+			return fmt.Errorf("node %s: keys are not sorted", n)
+		}
+		if (lo != nil && T.compare(k, *lo) < 0) || (hi != nil && T.compare(k, *hi) >= 0) {
+			return fmt.Errorf("node %s: key %s is outside the range of its parent", n, keyString(k))
+		}
+	}
+	if T.blink {
+		if (n.HighKey == nil) != (hi == nil) || (hi != nil && T.compare(*n.HighKey, *hi) != 0) {
+			return fmt.Errorf("node %s: high key does not match its parent", n)
+		}
+	}
+	if n.Leaf {
+		return nil
+	}
+	for i := range n.Children {
+		clo, chi := lo, hi
+		if i > 0 {
+			clo = &n.Keys[i-1]
+		}
+		if i < len(n.Keys) {
+			chi = &n.Keys[i]
+		}
+		c := T.read(n, i)
+		err := T.checkOrder(c, clo, chi)
+		if T.blink && i+1 < len(n.Children) && (c.RightSibling == nil || *c.RightSibling != n.Children[i+1]) {
+			err = fmt.Errorf("node %s: not linked to its right sibling", c)
+		}
+		T.unpin(c)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
 }
-func (T *BTree) validate() {
+
+// checkSiblings checks that the leaves are chained left to right, and that
+// keys are increasing along the chain. The walk unpins each leaf after the
+// callback, so what's checked is copied while it's pinned.
+func (T *BTree[K, V]) checkSiblings() error {
+	type leaf struct {
+		id          PageID
+		sibling     *PageID
+		first, last *K
+		name        string
+	}
+	var leaves []leaf
+	T.WalkNodes(T.Root, func(n *Node[K, V]) {
+		if !n.Leaf {
+			return
+		}
+		l := leaf{id: n.PageID, name: n.String()}
+		if n.RightSibling != nil {
+			id := *n.RightSibling
+			l.sibling = &id
+		}
+		if len(n.Keys) > 0 {
+			first, last := n.Keys[0], n.Keys[len(n.Keys)-1]
+			l.first, l.last = &first, &last
+		}
+		leaves = append(leaves, l)
+	})
+	for i, n := range leaves {
+		if i+1 == len(leaves) {
+			if n.sibling != nil {
+				return fmt.Errorf("leaf %s: rightmost leaf has sibling %d", n.name, *n.sibling)
+			}
+			break
+		}
+		next := leaves[i+1]
+		if n.sibling == nil || *n.sibling != next.id {
+			return fmt.Errorf("leaf %s: right sibling is not %s", n.name, next.name)
+		}
+		if n.last != nil && next.first != nil && T.compare(*n.last, *next.first) >= 0 {
+			return fmt.Errorf("leaf %s: keys are not below its right sibling %s", n.name, next.name)
+		}
+	}
+	return nil
+}
+func (T *BTree[K, V]) validate() {
 	if !T.dbg {
 		return
 	}
+	// validate is deferred, and an operation that panics leaves the tree
+	// half changed, so its panic goes on instead
+	if r := recover(); r != nil {
+		panic(r)
+	}
 	if err := T.isValid(); err != nil {
 		panic(err)
 	}
 }
-func (T *BTree) read(n *Node, i int) *Node {
-	if len(n.Children) < i-1 || i < 0 {
+func (T *BTree[K, V]) read(n *Node[K, V], i int) *Node[K, V] {
+	if i >= len(n.Children) || i < 0 {
 		return nil
 	}
 	id := n.Children[i]
-	return T.pageCache.Read(id)
+	return T.load(id)
 }
-func (T *BTree) write(n *Node) *Node {
-	return T.pageCache.Write(n)
+
+// The tree has no way to report I/O errors, so the helpers below panic when
+// the buffer pool fails. Nodes returned by load, read and allocate are
+// pinned, and must be released with unpin. The root is always pinned.
+
+func (T *BTree[K, V]) load(id PageID) *Node[K, V] {
+	n, err := T.pool.Pin(id)
+	if err != nil {
+		panic(err)
+	}
+	return n
+}
+func (T *BTree[K, V]) unpin(n *Node[K, V]) {
+	T.pool.Unpin(n.PageID)
 }
-func (T *BTree) allocate() *Node {
-	return T.pageCache.Allocate()
+func (T *BTree[K, V]) allocate() *Node[K, V] {
+	n, err := T.pool.Allocate()
+	if err != nil {
+		panic(err)
+	}
+	return n
+}
+func (T *BTree[K, V]) free(n *Node[K, V]) {
+	if err := T.pool.Free(n.PageID); err != nil {
+		panic(err)
+	}
+}
+
+// Flush writes all modified nodes to disk, and empties the WAL
+func (T *BTree[K, V]) Flush() error {
+	if err := T.pool.Flush(); err != nil {
+		return err
+	}
+	return T.pager.Checkpoint()
 }
 
-func (T *BTree) String(n *Node) string {
+// Stats returns a snapshot of the page and buffer pool counters
+func (T *BTree[K, V]) Stats() Stats {
+	return T.pager.Stats()
+}
+
+func (T *BTree[K, V]) String(n *Node[K, V]) string {
 	if n == nil {
 		panic("BTree.String(): n is nil")
 	}
@@ -78,6 +231,7 @@ func (T *BTree) String(n *Node) string {
 	for i := range n.Children {
 		c := T.read(n, i)
 		fmt.Fprintf(&s, "%s", T.String(c))
+		T.unpin(c)
 	}
 	// }
 	s.WriteString(")")
@@ -85,17 +239,18 @@ func (T *BTree) String(n *Node) string {
 	return s.String()
 }
 
-func (T *BTree) WalkNodes(n *Node, f func(n *Node)) {
+func (T *BTree[K, V]) WalkNodes(n *Node[K, V], f func(n *Node[K, V])) {
 	if n == nil {
 		return
 	}
 	f(n)
 	for _, id := range n.Children {
-		c := T.pageCache.Read(id)
+		c := T.load(id)
 		T.WalkNodes(c, f)
+		T.unpin(c)
 	}
 }
-func (T *BTree) Walk(n *Node, f func(key int)) {
+func (T *BTree[K, V]) Walk(n *Node[K, V], f func(key K)) {
 	if n == nil {
 		return
 	}
@@ -103,17 +258,19 @@ func (T *BTree) Walk(n *Node, f func(key int)) {
 		if !n.Leaf {
 			c := T.read(n, i)
 			T.Walk(c, f)
+			T.unpin(c)
 		}
 		f(key)
 	}
 	if !n.Leaf {
 		c := T.read(n, len(n.Keys))
 		T.Walk(c, f)
+		T.unpin(c)
 	}
 }
-func (b *BTree) Keys() []int {
-	var res []int
-	b.Walk(b.Root, func(key int) {
+func (b *BTree[K, V]) Keys() []K {
+	var res []K
+	b.Walk(b.Root, func(key K) {
 		res = append(res, key)
 	})
 	return res
@@ -121,218 +278,231 @@ func (b *BTree) Keys() []int {
 
 // returns nil if node does not have any keys, or the key is greater
 // than all keys in this set, in which case - consider calling T.lastChild
-func (T *BTree) insertionIndex(key int, node *Node) *int {
-	if len(node.Keys) == 0 || key > node.Keys[len(node.Keys)-1] {
+func (T *BTree[K, V]) insertionIndex(key K, node *Node[K, V]) *int {
+	if len(node.Keys) == 0 || T.compare(key, node.Keys[len(node.Keys)-1]) > 0 {
 		return nil
 	}
 	// otherwise we knwo for sure there's at least one key that is greater
 	for i, k := range node.Keys {
-		if k >= key {
+		if T.compare(k, key) >= 0 {
 			return &i
 		}
 	}
 	panic("unreachable")
 }
 
-func (T *BTree) lastChild(N *Node) *Node {
+func (T *BTree[K, V]) lastChild(N *Node[K, V]) *Node[K, V] {
 	length := len(N.Children)
 	if length == 0 {
 		return nil
 	}
 	pageID := N.Children[length-1]
-	return T.pageCache.Read(pageID)
+	return T.load(pageID)
 }
 
-func (T *BTree) Find(key int) *Match {
-	C := T.Root
-	var count int
-	for !C.Leaf {
-		count++
-		if count > 100 {
-			panic("infinite loop")
-		}
-		i := T.insertionIndex(key, C)
-		if i == nil {
-			C = T.lastChild(C)
-			continue
-		}
-		if C.Keys[*i] == key {
-			C = T.read(C, *i+1)
-		} else {
-			C = T.read(C, *i)
-		}
-	}
+// Find returns the first key >= key in the leaf where key is or would be,
+// or nil if there's none. The match is on a copy of the leaf.
+func (T *BTree[K, V]) Find(key K) *Match[K, V] {
+	C, _, _ := T.descend(T.toKey(key))
 	i := T.insertionIndex(key, C)
 	if i == nil {
 		return nil
 	}
-	return &Match{C, *i}
+	return &Match[K, V]{C, *i}
 }
 
-func (T *BTree) Range(key, upper int) RangeIterator {
-	C := T.Root
-	for !C.Leaf {
-		i := T.insertionIndex(key, C)
-		if i == nil {
-			C = T.lastChild(C)
-			continue
-		}
-		if C.Keys[*i] == key {
-			C = T.read(C, *i+1)
-		} else {
-			C = T.read(C, *i)
-		}
-	}
-	i := T.insertionIndex(key, C)
-	if i == nil {
-		return NewEmptyIterator[Match]()
-	}
-
-	j := *i
-	return NewIterator(func() *Match {
-		m := Match{Index: j, Node: C}
-		if j >= len(C.Keys) {
-			if C.RightSibling == nil {
-				return nil
-			}
-			// otherwise visit next sibling
-			C = T.pageCache.Read(*C.RightSibling)
-			j = 0
-			m = Match{Index: j, Node: C}
-		}
-		if C.Keys[j] >= upper {
+// Range iterates over keys in [key, upper). Matches are on copies of the
+// leaves, and the iterator holds no pins or latches between calls to Next.
+func (T *BTree[K, V]) Range(key, upper K) RangeIterator[K, V] {
+	c := T.Cursor()
+	ok := c.SeekGE(key)
+	return NewIterator(func() *Match[K, V] {
+		if !ok || T.compare(c.Key(), upper) >= 0 {
 			return nil
 		}
-		j++
-		return &m
+		m := &Match[K, V]{Node: c.leaf, Index: c.index}
+		ok = c.Next()
+		return m
 	})
 }
 
-func (T *BTree) Insert(key int, value PageID) {
-	node := T.Root
+// Insert adds key with value, or replaces the value if key is already there
+func (T *BTree[K, V]) Insert(key K, value V) {
+	if T.blink {
+		T.insertLink(key, value)
+		return
+	}
 	defer T.validate()
+	w := T.writer()
 
-	var stack []*Node
-	for !node.Leaf {
-		stack = append(stack, node)
-		if i := T.insertionIndex(key, node); i != nil {
-			node = T.read(node, *i)
-		} else {
-			node = T.lastChild(node)
+	// held is the path of write latched nodes, from the highest one that may
+	// be split down to the leaf. The root latch is held while the root may
+	// be split.
+	var held []*Node[K, V]
+	T.rootLatch.Lock()
+	rootLatched := true
+	release := func() {
+		for _, n := range held {
+			T.wunlatch(n)
+		}
+		held = nil
+		if rootLatched {
+			T.rootLatch.Unlock()
+			rootLatched = false
+		}
+	}
+	node := T.wlatch(T.Root.PageID)
+	for {
+		if !T.mayNeedSplit(node) {
+			release()
+		}
+		held = append(held, node)
+		if node.Leaf {
+			break
+		}
+		node = T.wlatch(node.Children[T.childIndex(key, node)])
+	}
+
+	// nodes created by splits are only reachable through latched parents,
+	// so they're pinned but not latched
+	var pinned []*Node[K, V]
+	defer func() {
+		if err := w.commit(); err != nil {
+			panic(err)
 		}
+		release()
+		for _, n := range pinned {
+			T.unpin(n)
+		}
+	}()
+
+	if leaf := held[len(held)-1]; T.replace(leaf, key, value) {
+		w.write(leaf)
+		return
 	}
-	stack = append(stack, node) // append the leaf, too
 
 	// we'll loop over the nodes, bottom-up - starting with the leaf node
+	stack := slices.Clone(held)
 	slices.Reverse(stack)
 
-	pageID := value
+	// the leaf gets the value, and parents of split nodes get the new node
+	var pageID PageID
 	minKey := key
-	var par *Node
-	fmt.Printf("-- stack --\n")
-	for _, node := range stack {
-		fmt.Printf("%s\n", node.String())
-	}
-	fmt.Printf("-- stack end --\n")
+	var par *Node[K, V]
 	for i, node := range stack {
 		// insert a given key and pageID into the parent node.
 		// We keep doing this while splitting is necessary
-		fmt.Printf("--- iteration start -- node=%s\n", node.String())
-		fmt.Printf("will insert %s in node %s\n", keyString(minKey), T.String(node))
-		T.insertInNode(node, minKey, pageID)
+		T.log.Debug("Insert", "key", keyString(minKey), "node", node.String())
+		T.insertInNode(node, minKey, value, pageID)
 
 		if !T.NeedsSplit(node) {
+			w.write(node)
 			break
 		}
-		fmt.Printf("node needs split\n")
 		// otherwise we need to split. Split and add new key to parent
 		j := (T.n + 1) / 2 // ceil[n/2]
-		pre := T.String(node)
-		right, mk := T.Split(node, j)
+		right, mk := w.split(node, j)
+		pinned = append(pinned, right)
+		T.log.Debug("Split", "left", node.String(), "right", right.String(), "separator", keyString(mk))
 		if i+1 < len(stack) {
 			par = stack[i+1]
 		} else {
 			par = nil
 		}
-		var parStr string = "<nil>"
-		if par != nil {
-			parStr = par.String()
-		}
-		fmt.Printf("split done\n  start=%s\n  left=%s\n  right=%s\n  par=  %s\n", pre, T.String(node), T.String(right), parStr)
 		if par == nil {
-			fmt.Printf("parent is nil, so we create a new root node\n")
+			// the root was split, so we create a new root node. The root
+			// latch is still held, since the root was not safe.
 			par = T.allocate()
-			par.Keys = []int{mk} // not sure of this
+			pinned = append(pinned, par)
+			par.Keys = []K{mk}
 			par.Children = []PageID{node.PageID, right.PageID}
 			par.Leaf = false
-			T.Root = par
-			fmt.Printf("root is now %s\n", T.String(par))
+			w.write(par)
+			w.setRoot(par)
+			T.log.Debug("New root", "node", par.String())
 			return // no need to continue down. we know we we're done
-		} else {
-			// T.insertInNode(par, right.MinKey(), right.PageID)
-			fmt.Printf("parent exists, will add %s to %s in next iteration\n", keyString(mk), par.String())
 		}
 
 		// otherwise, we have split and we need to register the new
-		// key to the parent.
-		// fmt.Printf("parent is %s and will insert %s\n", par, keyString(right.MinKey()))
-		minKey = mk // what if we remove extra keys?? then we're fucked
+		// key to the parent in the next iteration
+		minKey = mk
 		pageID = right.PageID
+	}
+}
 
+// replace sets the value of key in leaf, and reports whether key is there
+func (T *BTree[K, V]) replace(leaf *Node[K, V], key K, value V) bool {
+	i, found := slices.BinarySearchFunc(leaf.Keys, key, T.compare)
+	if found {
+		leaf.Values[i] = value
 	}
+	return found
 }
 
-// inserts the key at the appropriate location. value is either a leaf value,
-// or a pointer to a child page, which is put to the RIGHT
-func (T *BTree) insertInNode(node *Node, key int, value PageID) {
+// inserts the key at the appropriate location, along with value if node is
+// a leaf, or else child, which is put to the RIGHT
+func (T *BTree[K, V]) insertInNode(node *Node[K, V], key K, value V, child PageID) {
 	i := T.insertionIndex(key, node)
 	if i == nil {
 		node.Keys = append(node.Keys, key)
 		if node.Leaf {
 			node.Values = append(node.Values, value)
 		} else {
-			node.Children = append(node.Children, value) // seems about right
+			node.Children = append(node.Children, child) // seems about right
 		}
 	} else {
 		node.Keys = slices.Insert(node.Keys, *i, key)
 		if node.Leaf {
-			node.Values = slices.Insert(node.Values, *i+1, value)
+			node.Values = slices.Insert(node.Values, *i, value)
 		} else {
-			node.Children = slices.Insert(node.Children, *i+1, value)
+			node.Children = slices.Insert(node.Children, *i+1, child)
 		}
 	}
 }
 
-func (T *BTree) NeedsSplit(n *Node) bool {
+func (T *BTree[K, V]) NeedsSplit(n *Node[K, V]) bool {
 	return T.n == len(n.Keys)-1
 }
 
+// mayNeedSplit reports whether n needs a split after one more key, i.e.
+// whether it's not safe for Insert
+func (T *BTree[K, V]) mayNeedSplit(n *Node[K, V]) bool {
+	return len(n.Keys) >= T.n
+}
+
 // Splits current node at index i, returning the new node, along with the key that should
-// be used as the separation key for parent nodes
-func (T *BTree) Split(node *Node, i int) (*Node, int) {
-	right := T.pageCache.Allocate()
+// be used as the separation key for parent nodes. The new node is pinned.
+func (w *writer[K, V]) split(node *Node[K, V], i int) (*Node[K, V], K) {
+	right := w.allocate()
 	right.Leaf = node.Leaf
 
-	right.Keys = node.Keys[i:]
-	node.Keys = node.Keys[:i]
+	// the halves must not share backing arrays, since both nodes stay in
+	// the buffer pool and may grow later
+	right.Keys = slices.Clone(node.Keys[i:])
+	node.Keys = slices.Clip(node.Keys[:i])
 
 	right.RightSibling = node.RightSibling
 	tmp := right.PageID
 	node.RightSibling = &tmp
 
+	var separationKey K
 	if node.Leaf {
-		right.Values = node.Values[i:]
-		node.Values = node.Values[:i]
-		return right, right.MinKey()
+		right.Values = slices.Clone(node.Values[i:])
+		node.Values = slices.Clip(node.Values[:i])
+		separationKey = right.MinKey()
 	} else {
-		right.Children = node.Children[i+1:]
-		node.Children = node.Children[:i+1]
+		right.Children = slices.Clone(node.Children[i+1:])
+		node.Children = slices.Clip(node.Children[:i+1])
+		separationKey = right.Keys[0]
 		if len(right.Keys) == len(right.Children) {
-			fmt.Printf("removing extraneous key %s -> now keys=%v\n", keyString(right.Keys[0]), right.Keys[1:])
-			separationKey := right.Keys[0]
 			right.Keys = right.Keys[1:]
-			return right, separationKey
 		}
-		return right, right.Keys[0]
 	}
+	if w.blink {
+		right.HighKey = node.HighKey
+		node.HighKey = &separationKey
+	}
+	w.write(node)
+	w.write(right)
+	return right, separationKey
 }
@@ -1,8 +1,13 @@
 package bplus
 
 import (
+	"errors"
 	"fmt"
+	"io"
+	"maps"
+	"math/rand"
 	"os"
+	"slices"
 	"testing"
 )
 
@@ -48,9 +53,9 @@ func TestFind(t *testing.T) {
 		t.Run(fmt.Sprintf("%s/%d", tc.input, tc.key), func(t *testing.T) {
 			tree := FromString(2, tc.input, os.Stderr)
 			got := tree.Find(tc.key)
-			var want *Match
+			var want *Match[int, PageID]
 			if tc.want != "" {
-				want = &Match{
+				want = &Match[int, PageID]{
 					Node:  FromString(2, tc.want, os.Stderr).Root,
 					Index: tc.index,
 				}
@@ -93,6 +98,11 @@ func TestRange(t *testing.T) {
 			lower: -1, upper: 12,
 			want: []string{"(12)/0", "(12)/1", "(34)/0", "(34)/1"},
 		},
+		{
+			input: "(5(12)(56))", // starts past the first leaf
+			lower: 3, upper: 9,
+			want: []string{"(56)/0", "(56)/1"},
+		},
 		{
 			input: "(123)", // root only
 			lower: 1, upper: 3,
@@ -150,7 +160,42 @@ func TestInsert(t *testing.T) {
 	}
 }
 
-func expectMatches(t *testing.T, want []string, got Iterator[Match]) {
+// inserting a key that's there replaces its value
+func TestInsertExisting(t *testing.T) {
+	for _, blink := range []bool{false, true} {
+		t.Run(fmt.Sprintf("blink=%t", blink), func(t *testing.T) {
+			tree, err := Open(3, &memFile{}, Options{PageSize: 256, Frames: 20, BLink: blink, Validate: true}, io.Discard)
+			if err != nil {
+				t.Fatal(err)
+			}
+			keys := rand.New(rand.NewSource(2)).Perm(100)
+			for _, k := range keys {
+				tree.Insert(k, PageID(k))
+			}
+			for _, k := range keys[:50] {
+				tree.Insert(k, PageID(k+1000))
+			}
+			if err := tree.isValid(); err != nil {
+				t.Fatal(err)
+			}
+			want := slices.Sorted(slices.Values(keys))
+			if got := rangeKeys(tree); !slices.Equal(got, want) {
+				t.Fatalf("keys mismatch;\nwant= %v\ngot = %v", want, got)
+			}
+			for i, k := range keys {
+				value := PageID(k)
+				if i < 50 {
+					value += 1000
+				}
+				if m := tree.Find(k); m == nil || m.Node.Values[m.Index] != value {
+					t.Fatalf("Find(%d) = %v; want value %d", k, m, value)
+				}
+			}
+		})
+	}
+}
+
+func expectMatches(t *testing.T, want []string, got Iterator[Match[int, PageID]]) {
 	t.Helper()
 	for i, w := range want {
 		gotMatch := got.Next()
@@ -166,7 +211,7 @@ func expectMatches(t *testing.T, want []string, got Iterator[Match]) {
 	}
 }
 
-func expectMatch(t *testing.T, want, got *Match) {
+func expectMatch(t *testing.T, want, got *Match[int, PageID]) {
 	t.Helper()
 	if want == nil {
 		if got != nil {
@@ -182,14 +227,14 @@ func expectMatch(t *testing.T, want, got *Match) {
 	}
 }
 
-func expectTree(t *testing.T, want string, got *BTree) {
+func expectTree(t *testing.T, want string, got *BTree[int, PageID]) {
 	t.Helper()
 	gotStr := got.String(got.Root)
 	if gotStr != want {
 		t.Fatalf("tree structure mismatch;\nwant= %s\ngot = %s", want, gotStr)
 	}
 }
-func expectNode(t *testing.T, got *Node, want string) {
+func expectNode(t *testing.T, got *Node[int, PageID], want string) {
 	t.Helper()
 	if want == "" {
 		if got != nil {
@@ -201,3 +246,158 @@ func expectNode(t *testing.T, got *Node, want string) {
 		t.Fatalf("unexpected node structure;\nwant= %s\ngot = %s", want, got.String())
 	}
 }
+
+func TestDelete(t *testing.T) {
+	cases := []struct {
+		input string
+		key   int
+		want  string
+		found bool
+	}{
+		{
+			input: "(c(ab)(cde))", // leaf stays full enough
+			key:   'd',
+			want:  "(c(ab)(ce))",
+			found: true,
+		},
+		{
+			input: "(c(ab)(cde))", // borrow from the right
+			key:   'a',
+			want:  "(d(bc)(de))",
+			found: true,
+		},
+		{
+			input: "(d(abc)(de))", // borrow from the left
+			key:   'e',
+			want:  "(c(ab)(cd))",
+			found: true,
+		},
+		{
+			input: "(c(ab)(cd))", // merge, root collapses
+			key:   'd',
+			want:  "(abc)",
+			found: true,
+		},
+		{
+			input: "(e(c(ab)(cd))(g(ef)(gh)))", // internal nodes merge
+			key:   'h',
+			want:  "(ce(ab)(cd)(efg))",
+			found: true,
+		},
+		{
+			input: "(g(ce(ab)(cd)(ef))(i(gh)(ij)))", // internal node borrows
+			key:   'j',
+			want:  "(e(c(ab)(cd))(g(ef)(ghi)))",
+			found: true,
+		},
+		{
+			input: "(c(ab)(cd))", // missing key
+			key:   'z',
+			want:  "(c(ab)(cd))",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(fmt.Sprintf("%s/%s", tc.input, keyString(tc.key)), func(t *testing.T) {
+			tree := FromString(3, tc.input, os.Stderr)
+			if got := tree.Delete(tc.key); got != tc.found {
+				t.Fatalf("Delete returned %v; want %v", got, tc.found)
+			}
+			expectTree(t, tc.want, tree)
+			if m := tree.Find(tc.key); m != nil && m.Node.Keys[m.Index] == tc.key {
+				t.Fatalf("deleted key %s is still found", keyString(tc.key))
+			}
+		})
+	}
+}
+
+func TestDeleteRandom(t *testing.T) {
+	tree, err := Open(3, &memFile{}, Options{PageSize: 256, Validate: true}, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := rand.New(rand.NewSource(5))
+	keys := r.Perm(200)
+	for _, k := range keys {
+		tree.Insert(k, PageID(k))
+	}
+
+	r.Shuffle(len(keys), func(i, j int) { keys[i], keys[j] = keys[j], keys[i] })
+	for i, k := range keys {
+		if !tree.Delete(k) {
+			t.Fatalf("Delete(%d) = false", k)
+		}
+		if tree.Delete(k) {
+			t.Fatalf("Delete(%d) twice = true", k)
+		}
+		if err := tree.isValid(); err != nil {
+			t.Fatalf("after deleting %d: %v", k, err)
+		}
+		want := slices.Sorted(slices.Values(keys[i+1:]))
+		if got := rangeKeys(tree); !slices.Equal(got, want) {
+			t.Fatalf("after deleting %d: keys = %v; want %v", k, got, want)
+		}
+	}
+	if !tree.Root.Leaf || len(tree.Root.Keys) != 0 {
+		t.Fatalf("want an empty root leaf, got %s", tree.String(tree.Root))
+	}
+
+	// freed pages are reused
+	numPages := tree.pager.numPages
+	for _, k := range keys[:50] {
+		tree.Insert(k, PageID(k))
+	}
+	if tree.pager.numPages != numPages {
+		t.Fatalf("file grew from %d to %d pages; want freed pages reused", numPages, tree.pager.numPages)
+	}
+}
+
+// validation with a buffer pool small enough that it evicts nodes while the
+// tree is walked
+func TestValidateSmallPool(t *testing.T) {
+	for _, frames := range []int{10, 12} {
+		t.Run(fmt.Sprintf("frames=%d", frames), func(t *testing.T) {
+			tree, err := Open(3, &memFile{}, Options{PageSize: 128, Frames: frames, Validate: true}, io.Discard)
+			if err != nil {
+				t.Fatal(err)
+			}
+			model := map[int]PageID{}
+			r := rand.New(rand.NewSource(int64(frames)))
+			for range 2000 {
+				k := r.Intn(300)
+				if r.Intn(3) == 0 {
+					_, ok := model[k]
+					if tree.Delete(k) != ok {
+						t.Fatalf("Delete(%d) = %t", k, !ok)
+					}
+					delete(model, k)
+				} else {
+					tree.Insert(k, 0)
+					model[k] = 0
+				}
+			}
+			want := slices.Sorted(maps.Keys(model))
+			if got := rangeKeys(tree); !slices.Equal(got, want) {
+				t.Fatalf("keys = %v; want %v", got, want)
+			}
+		})
+	}
+}
+
+// validation doesn't hide the panic of an operation that failed halfway
+func TestValidatePanic(t *testing.T) {
+	tree, err := Open(3, &memFile{}, Options{PageSize: 128, Frames: 8, Validate: true}, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err, _ := recover().(error); !errors.Is(err, ErrNoFrames) {
+			t.Fatalf("got panic %v; want ErrNoFrames", err)
+		}
+	}()
+	r := rand.New(rand.NewSource(1))
+	for range 2000 {
+		tree.Insert(r.Intn(300), 0)
+	}
+	t.Fatalf("want the buffer pool to run out of frames")
+}
@@ -0,0 +1,284 @@
+package bplus
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"sync"
+)
+
+// Transactions
+//
+// A TxTree keeps every version of a value, and each version is stamped with
+// the commit timestamps it began and ended at. The begin timestamp is the
+// sequence number of the key (see Dup), so the versions of a key are next to
+// each other, oldest first. The end timestamp is stored with the value, and
+// is live until the value is overwritten or deleted.
+//
+// A transaction sees the versions that were live at the last commit before it
+// began, so it reads a consistent snapshot. Its writes are kept aside until
+// it commits, and they're given the next timestamp then. If another
+// transaction committed a change to one of the same keys in the meantime,
+// Commit fails with a ConflictError; the first committer wins.
+//
+// A version is ended by a single Insert, which replaces it with a copy
+// stamped with the end timestamp. Commits hold S.mu exclusively, since the
+// conflict check and the writes must not interleave with those of another
+// commit, and the clock must not move until all the writes are in. Get read
+// locks it, so that Vacuum doesn't remove the versions it reads, and that
+// keeps readers out during commits as well. Commits are not atomic across a
+// crash.
+
+var (
+	// ErrConflict is wrapped by a ConflictError
+	ErrConflict = errors.New("tx: write-write conflict")
+	ErrTxDone   = errors.New("tx: transaction has already been committed or rolled back")
+)
+
+// ConflictError is returned by Commit when another transaction committed a
+// change to Key after the transaction began
+type ConflictError[K any] struct {
+	Key K
+}
+
+func (e *ConflictError[K]) Error() string {
+	return fmt.Sprintf("tx: write-write conflict on key %s", keyString(e.Key))
+}
+func (e *ConflictError[K]) Unwrap() error { return ErrConflict }
+
+// live is the end timestamp of a version that has not ended
+const live = math.MaxUint64
+
+type version[V any] struct {
+	End   uint64
+	Value V
+}
+
+type versionCodec[V any] struct {
+	value Codec[V]
+}
+
+func (c versionCodec[V]) Append(b []byte, v version[V]) []byte {
+	return c.value.Append(binary.BigEndian.AppendUint64(b, v.End), v.Value)
+}
+func (c versionCodec[V]) Decode(b []byte) (version[V], error) {
+	if len(b) < 8 {
+		return version[V]{}, fmt.Errorf("version: bad length %d", len(b))
+	}
+	v, err := c.value.Decode(b[8:])
+	if err != nil {
+		return version[V]{}, err
+	}
+	return version[V]{End: binary.BigEndian.Uint64(b[:8]), Value: v}, nil
+}
+func (c versionCodec[V]) MaxSize() int {
+	if n := c.value.MaxSize(); n > 0 {
+		return n + 8
+	}
+	return 0
+}
+
+// TxTree is a tree that is read and changed through transactions
+type TxTree[K, V any] struct {
+	tree    *BTree[Dup[K], version[V]]
+	compare func(a, b K) int
+
+	// mu is write locked while versions are ended or removed, and read
+	// locked by Get
+	mu     sync.RWMutex
+	clock  uint64         // timestamp of the last commit
+	active map[uint64]int // the number of active transactions by start
+}
+
+// OpenTx returns the transactional tree stored in f; see OpenWith. The clock
+// is recovered by reading every leaf.
+func OpenTx[K, V any](n int, f File, schema Schema[K, V], opts Options, w io.Writer) (*TxTree[K, V], error) {
+	vschema := Schema[Dup[K], version[V]]{
+		Compare: DupSchema(schema).Compare,
+		Key:     dupCodec[K]{schema.Key},
+		Value:   versionCodec[V]{schema.Value},
+	}
+	T, err := OpenWith(n, f, vschema, opts, w)
+	if err != nil {
+		return nil, err
+	}
+	S := &TxTree[K, V]{tree: T, compare: schema.Compare, active: map[uint64]int{}}
+	T.WalkNodes(T.Root, func(n *Node[Dup[K], version[V]]) {
+		if !n.Leaf {
+			return
+		}
+		for i, k := range n.Keys {
+			S.clock = max(S.clock, k.Seq)
+			if end := n.Values[i].End; end != live {
+				S.clock = max(S.clock, end)
+			}
+		}
+	})
+	return S, nil
+}
+
+func (S *TxTree[K, V]) Flush() error {
+	return S.tree.Flush()
+}
+
+// latest returns the newest version of key that began at or before ts
+func (S *TxTree[K, V]) latest(key K, ts uint64) (Dup[K], version[V], bool) {
+	c := S.tree.Cursor()
+	if !c.SeekLE(Dup[K]{Key: key, Seq: ts}) || S.compare(c.Key().Key, key) != 0 {
+		return Dup[K]{}, version[V]{}, false
+	}
+	return c.Key(), c.Value(), true
+}
+
+// Vacuum removes the versions that no transaction can see, which are those
+// that ended before the oldest active transaction began. It returns the
+// number of versions removed.
+func (S *TxTree[K, V]) Vacuum() int {
+	S.mu.Lock()
+	defer S.mu.Unlock()
+
+	horizon := S.clock
+	for start := range S.active {
+		horizon = min(horizon, start)
+	}
+	var dead []Dup[K]
+	for k, v := range S.tree.All() {
+		if v.End <= horizon {
+			dead = append(dead, k)
+		}
+	}
+	for _, k := range dead {
+		S.tree.Delete(k)
+	}
+	return len(dead)
+}
+
+// Tx is a transaction. It is not safe for concurrent use, but many
+// transactions may run at once.
+type Tx[K, V any] struct {
+	S      *TxTree[K, V]
+	start  uint64
+	writes []write[K, V] // sorted by key
+	done   bool
+}
+
+type write[K, V any] struct {
+	key     K
+	value   V
+	deleted bool
+}
+
+// Begin starts a transaction, which sees the tree as of the last commit
+func (S *TxTree[K, V]) Begin() *Tx[K, V] {
+	S.mu.Lock()
+	defer S.mu.Unlock()
+	S.active[S.clock]++
+	return &Tx[K, V]{S: S, start: S.clock}
+}
+
+// find returns the index of key in the writes, and whether it's there
+func (tx *Tx[K, V]) find(key K) (int, bool) {
+	return slices.BinarySearchFunc(tx.writes, key, func(w write[K, V], key K) int {
+		return tx.S.compare(w.key, key)
+	})
+}
+
+// Get returns the value of key, and false if it has none
+func (tx *Tx[K, V]) Get(key K) (V, bool, error) {
+	var zero V
+	if tx.done {
+		return zero, false, ErrTxDone
+	}
+	if i, ok := tx.find(key); ok {
+		w := tx.writes[i]
+		return w.value, !w.deleted, nil
+	}
+
+	tx.S.mu.RLock()
+	defer tx.S.mu.RUnlock()
+	_, v, ok := tx.S.latest(key, tx.start)
+	if !ok || v.End <= tx.start {
+		return zero, false, nil
+	}
+	return v.Value, true, nil
+}
+
+// Put sets the value of key when the transaction commits
+func (tx *Tx[K, V]) Put(key K, value V) error {
+	return tx.set(write[K, V]{key: key, value: value})
+}
+
+// Delete removes key when the transaction commits
+func (tx *Tx[K, V]) Delete(key K) error {
+	return tx.set(write[K, V]{key: key, deleted: true})
+}
+
+func (tx *Tx[K, V]) set(w write[K, V]) error {
+	if tx.done {
+		return ErrTxDone
+	}
+	if i, ok := tx.find(w.key); ok {
+		tx.writes[i] = w
+	} else {
+		tx.writes = slices.Insert(tx.writes, i, w)
+	}
+	return nil
+}
+
+// Commit applies the writes of the transaction, unless another transaction
+// has committed a change to the same keys since it began. Then nothing is
+// applied, and a ConflictError is returned.
+func (tx *Tx[K, V]) Commit() error {
+	if tx.done {
+		return ErrTxDone
+	}
+	S := tx.S
+	S.mu.Lock()
+	defer S.mu.Unlock()
+	defer tx.end()
+
+	for _, w := range tx.writes {
+		k, v, ok := S.latest(w.key, live)
+		if ok && (k.Seq > tx.start || v.End != live && v.End > tx.start) {
+			return &ConflictError[K]{Key: w.key}
+		}
+	}
+	if len(tx.writes) == 0 {
+		return nil
+	}
+
+	ts := S.clock + 1
+	for _, w := range tx.writes {
+		if k, v, ok := S.latest(w.key, live); ok && v.End == live {
+			v.End = ts
+			S.tree.Insert(k, v)
+		}
+		if !w.deleted {
+			S.tree.Insert(Dup[K]{Key: w.key, Seq: ts}, version[V]{End: live, Value: w.value})
+		}
+	}
+	S.clock = ts
+	return nil
+}
+
+// Rollback discards the writes of the transaction
+func (tx *Tx[K, V]) Rollback() error {
+	if tx.done {
+		return ErrTxDone
+	}
+	tx.S.mu.Lock()
+	defer tx.S.mu.Unlock()
+	tx.end()
+	return nil
+}
+
+// end marks the transaction as done. S.mu must be held.
+func (tx *Tx[K, V]) end() {
+	tx.done = true
+	if tx.S.active[tx.start]--; tx.S.active[tx.start] == 0 {
+		delete(tx.S.active, tx.start)
+	}
+}
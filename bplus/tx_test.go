@@ -0,0 +1,217 @@
+package bplus
+
+import (
+	"errors"
+	"io"
+	"math/rand"
+	"sync"
+	"testing"
+)
+
+func openTx(t *testing.T, f File) *TxTree[string, int] {
+	t.Helper()
+	S, err := OpenTx(3, f, StringSchema[int](intValues{}), Options{PageSize: 256}, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return S
+}
+
+func expectGet(t *testing.T, tx *Tx[string, int], key string, want int, wantOK bool) {
+	t.Helper()
+	got, ok, err := tx.Get(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok != wantOK || got != want {
+		t.Fatalf("Get(%q) = %d, %t; want %d, %t", key, got, ok, want, wantOK)
+	}
+}
+
+func TestTx(t *testing.T) {
+	S := openTx(t, &memFile{})
+
+	tx := S.Begin()
+	tx.Put("a", 1)
+	tx.Put("b", 2)
+	expectGet(t, tx, "a", 1, true) // its own writes
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	// old sees the tree as of the first commit, whatever happens after
+	old := S.Begin()
+	tx = S.Begin()
+	tx.Put("a", 10)
+	tx.Delete("b")
+	tx.Put("c", 3)
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	expectGet(t, old, "a", 1, true)
+	expectGet(t, old, "b", 2, true)
+	expectGet(t, old, "c", 0, false)
+
+	tx = S.Begin()
+	expectGet(t, tx, "a", 10, true)
+	expectGet(t, tx, "b", 0, false)
+	expectGet(t, tx, "c", 3, true)
+	tx.Put("c", 30)
+	if err := tx.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Put("c", 30); !errors.Is(err, ErrTxDone) {
+		t.Fatalf("Put after Rollback: want ErrTxDone, got %v", err)
+	}
+	tx = S.Begin()
+	expectGet(t, tx, "c", 3, true)
+}
+
+func TestTxConflict(t *testing.T) {
+	S := openTx(t, &memFile{})
+	setup := S.Begin()
+	setup.Put("a", 1)
+	setup.Commit()
+
+	cases := []struct {
+		desc  string
+		other func(tx *Tx[string, int])
+	}{
+		{"put", func(tx *Tx[string, int]) { tx.Put("a", 2) }},
+		{"delete", func(tx *Tx[string, int]) { tx.Delete("a") }},
+		{"put after delete", func(tx *Tx[string, int]) { tx.Delete("a"); tx.Put("a", 3) }},
+	}
+	for _, tc := range cases {
+		t.Run(tc.desc, func(t *testing.T) {
+			tx := S.Begin()
+			other := S.Begin()
+			tc.other(other)
+			if err := other.Commit(); err != nil {
+				t.Fatal(err)
+			}
+
+			tx.Put("a", 100)
+			tx.Put("b", 100)
+			err := tx.Commit()
+			var conflict *ConflictError[string]
+			if !errors.As(err, &conflict) || conflict.Key != "a" || !errors.Is(err, ErrConflict) {
+				t.Fatalf("want a conflict on %q, got %v", "a", err)
+			}
+			expectGet(t, S.Begin(), "b", 0, false)
+		})
+	}
+
+	// writes to other keys don't conflict
+	tx := S.Begin()
+	other := S.Begin()
+	other.Put("x", 1)
+	other.Commit()
+	tx.Put("y", 1)
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTxVacuum(t *testing.T) {
+	f := &memFile{}
+	S := openTx(t, f)
+	for i := range 10 {
+		tx := S.Begin()
+		tx.Put("a", i)
+		tx.Commit()
+	}
+	old := S.Begin()
+	for i := 10; i < 20; i++ {
+		tx := S.Begin()
+		tx.Put("a", i)
+		tx.Commit()
+	}
+
+	// old still needs the version it sees, and the ones after it
+	if n := S.Vacuum(); n != 9 {
+		t.Fatalf("Vacuum with an old transaction removed %d versions; want 9", n)
+	}
+	expectGet(t, old, "a", 9, true)
+	old.Commit()
+	if n := S.Vacuum(); n != 10 {
+		t.Fatalf("Vacuum removed %d versions; want 10", n)
+	}
+	expectGet(t, S.Begin(), "a", 19, true)
+	if err := S.tree.isValid(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the clock continues where it left off
+	if err := S.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	S = openTx(t, f)
+	if S.clock != 20 {
+		t.Fatalf("clock after reopening = %d; want 20", S.clock)
+	}
+}
+
+// Transfers between accounts keep the total, so every snapshot must have the
+// same total
+func TestTxConcurrent(t *testing.T) {
+	S := openTx(t, &memFile{})
+	accounts := []string{"a", "b", "c", "d", "e", "f", "g", "h"}
+	const total = 1000
+	setup := S.Begin()
+	for _, a := range accounts {
+		setup.Put(a, total/len(accounts))
+	}
+	setup.Commit()
+
+	var wg sync.WaitGroup
+	errs := make(chan string, 8)
+	for w := range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rng := rand.New(rand.NewSource(int64(w)))
+			for committed := 0; committed < 50; {
+				from, to := accounts[rng.Intn(len(accounts))], accounts[rng.Intn(len(accounts))]
+				if from == to {
+					continue
+				}
+				tx := S.Begin()
+				a, _, _ := tx.Get(from)
+				b, _, _ := tx.Get(to)
+				tx.Put(from, a-1)
+				tx.Put(to, b+1)
+				if err := tx.Commit(); err == nil {
+					committed++
+				} else if !errors.Is(err, ErrConflict) {
+					errs <- err.Error()
+					return
+				}
+			}
+		}()
+	}
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 100 {
+				tx := S.Begin()
+				sum := 0
+				for _, a := range accounts {
+					v, _, _ := tx.Get(a)
+					sum += v
+				}
+				tx.Commit()
+				if sum != total {
+					errs <- "a snapshot did not add up"
+					return
+				}
+				S.Vacuum()
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+}
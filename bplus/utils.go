@@ -2,9 +2,11 @@ package bplus
 
 import "fmt"
 
-func keyString(k int) string {
-	if k >= 'A' && k <= 'Z' || k >= 'a' && k <= 'z' {
+// keyString shows int keys that are letters as letters, like FromString
+// reads them. Other keys are formatted with %v.
+func keyString(k any) string {
+	if k, ok := k.(int); ok && (k >= 'A' && k <= 'Z' || k >= 'a' && k <= 'z') {
 		return fmt.Sprintf("%c", k)
 	}
-	return fmt.Sprintf("%d", k)
+	return fmt.Sprintf("%v", k)
 }
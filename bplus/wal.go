@@ -0,0 +1,137 @@
+package bplus
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+// The write-ahead log is a sequence of records:
+//
+//	| length | crc32 | type | lsn | page | image ... |
+//
+// Every tree operation logs the images of the pages it changed, followed by
+// a commit record. Node images have their own type, since only node pages
+// carry an lsn that recovery can compare against. Only operations with a commit record are redone during
+// recovery, so a torn tail is simply ignored.
+
+// LogFile is where the write-ahead log is kept, e.g. an *os.File
+type LogFile interface {
+	io.ReaderAt
+	io.WriterAt
+	Truncate(size int64) error
+	Sync() error
+}
+
+type recordType uint8
+
+const (
+	recordPage recordType = iota + 1
+	recordCommit
+	recordNode // a page record with the image of a node
+)
+
+const recordHeaderSize = 4 + 4 + 1 + 8 + 2
+
+type walRecord struct {
+	typ   recordType
+	lsn   uint64
+	page  PageID
+	image []byte
+}
+
+type WAL struct {
+	file LogFile
+	size int64 // where the next record goes
+}
+
+func NewWAL(f LogFile) *WAL {
+	return &WAL{file: f}
+}
+
+func (w *WAL) Append(r walRecord) error {
+	b := make([]byte, recordHeaderSize+len(r.image))
+	binary.BigEndian.PutUint32(b[0:4], uint32(len(b)))
+	b[8] = uint8(r.typ)
+	binary.BigEndian.PutUint64(b[9:17], r.lsn)
+	binary.BigEndian.PutUint16(b[17:19], uint16(r.page))
+	copy(b[recordHeaderSize:], r.image)
+	binary.BigEndian.PutUint32(b[4:8], crc32.ChecksumIEEE(b[8:]))
+	if _, err := w.file.WriteAt(b, w.size); err != nil {
+		return fmt.Errorf("wal: append: %w", err)
+	}
+	w.size += int64(len(b))
+	return nil
+}
+
+func (w *WAL) Sync() error {
+	return w.file.Sync()
+}
+
+// Reset empties the log. Only safe once every logged page is on disk.
+func (w *WAL) Reset() error {
+	if err := w.file.Truncate(0); err != nil {
+		return err
+	}
+	w.size = 0
+	return w.file.Sync()
+}
+
+// Records reads the log from the start, and stops at the end or at the first
+// record that is incomplete or corrupt. Appends continue after the last good
+// record.
+func (w *WAL) Records() ([]walRecord, error) {
+	var (
+		res []walRecord
+		off int64
+	)
+	for {
+		var hdr [recordHeaderSize]byte
+		if n, err := w.file.ReadAt(hdr[:], off); n < len(hdr) {
+			if err != nil && !errors.Is(err, io.EOF) {
+				return nil, fmt.Errorf("wal: read: %w", err)
+			}
+			break
+		}
+		size := int64(binary.BigEndian.Uint32(hdr[0:4]))
+		if size < recordHeaderSize {
+			break
+		}
+		b := make([]byte, size)
+		if n, err := w.file.ReadAt(b, off); int64(n) < size {
+			if err != nil && !errors.Is(err, io.EOF) {
+				return nil, fmt.Errorf("wal: read: %w", err)
+			}
+			break
+		}
+		if crc32.ChecksumIEEE(b[8:]) != binary.BigEndian.Uint32(b[4:8]) {
+			break
+		}
+		res = append(res, walRecord{
+			typ:   recordType(b[8]),
+			lsn:   binary.BigEndian.Uint64(b[9:17]),
+			page:  PageID(binary.BigEndian.Uint16(b[17:19])),
+			image: b[recordHeaderSize:],
+		})
+		off += size
+	}
+	w.size = off
+	return res, nil
+}
+
+// committed returns the page records that belong to committed operations
+func committed(records []walRecord) []walRecord {
+	var res, group []walRecord
+	for _, r := range records {
+		switch r.typ {
+		case recordPage, recordNode:
+			group = append(group, r)
+		case recordCommit:
+			res = append(res, group...)
+			group = nil
+		}
+	}
+	return res
+}
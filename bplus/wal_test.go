@@ -0,0 +1,156 @@
+package bplus
+
+import (
+	"bytes"
+	"io"
+	"math"
+	"math/rand"
+	"slices"
+	"testing"
+
+	"github.com/kvalv/algos/page"
+)
+
+func rangeKeys(T *BTree[int, PageID]) []int {
+	var res []int
+	it := T.Range(math.MinInt, math.MaxInt)
+	for m := it.Next(); m != nil; m = it.Next() {
+		res = append(res, m.Node.Keys[m.Index])
+	}
+	return res
+}
+
+func TestRecovery(t *testing.T) {
+	data, log := &memFile{}, &memFile{}
+	opts := Options{PageSize: 128, WAL: log}
+	tree, err := Open(3, data, opts, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := rand.New(rand.NewSource(3)).Perm(30)
+	for _, k := range keys[:15] {
+		tree.Insert(k, PageID(k))
+	}
+	if err := tree.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if len(log.b) != 0 {
+		t.Fatalf("expected the log to be empty after a checkpoint")
+	}
+	for _, k := range keys[15:] {
+		tree.Insert(k, PageID(k))
+	}
+
+	// what we'd be left with after a crash; the nodes are still in the
+	// buffer pool, so the data file is as it was at the checkpoint
+	crashData := slices.Clone(data.b)
+	crashLog := slices.Clone(log.b)
+
+	// the keys we may end up with; everything up to the checkpoint plus
+	// zero or more of the inserts after it
+	var valid [][]int
+	for i := 15; i <= len(keys); i++ {
+		valid = append(valid, slices.Sorted(slices.Values(keys[:i])))
+	}
+
+	var last int
+	for off := 0; off <= len(crashLog); off++ {
+		d := &memFile{b: slices.Clone(crashData)}
+		l := &memFile{b: slices.Clone(crashLog[:off])}
+		reopened, err := Open(3, d, Options{PageSize: 128, WAL: l}, io.Discard)
+		if err != nil {
+			t.Fatalf("offset %d: failed to reopen: %s", off, err)
+		}
+		if err := reopened.isValid(); err != nil {
+			t.Fatalf("offset %d: invalid tree: %s", off, err)
+		}
+		got := rangeKeys(reopened)
+		i := slices.IndexFunc(valid, func(want []int) bool { return slices.Equal(want, got) })
+		if i == -1 {
+			t.Fatalf("offset %d: unexpected keys %v", off, got)
+		}
+		if i < last {
+			t.Fatalf("offset %d: lost a committed insert; had %d, now %d", off, last, i)
+		}
+		last = i
+	}
+	if last != len(valid)-1 {
+		t.Fatalf("expected all inserts to be recovered from the full log; got %d of %d", last, len(valid)-1)
+	}
+}
+
+func TestRecoveryAfterEviction(t *testing.T) {
+	// with a small buffer pool, some nodes reach the data file before the
+	// crash, and some don't
+	data, log := &memFile{}, &memFile{}
+	opts := Options{PageSize: 128, Frames: 16, WAL: log}
+	tree, err := Open(3, data, opts, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := rand.New(rand.NewSource(4)).Perm(200)
+	for _, k := range keys {
+		tree.Insert(k, PageID(k))
+	}
+	if tree.Stats().Evictions == 0 {
+		t.Fatalf("expected evictions")
+	}
+
+	reopened, err := Open(3, data, opts, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := reopened.isValid(); err != nil {
+		t.Fatal(err)
+	}
+	slices.Sort(keys)
+	if got := rangeKeys(reopened); !slices.Equal(got, keys) {
+		t.Fatalf("keys mismatch;\nwant= %v\ngot = %v", keys, got)
+	}
+
+	// the recovered tree keeps working, and stamps newer lsns
+	reopened.Insert(1000, 0)
+	if m := reopened.Find(1000); m == nil || m.Node.LSN <= tree.pager.lsn {
+		t.Fatalf("expected a new lsn for the inserted key; got %v", m)
+	}
+}
+
+func TestRecoveryRedoesOtherPages(t *testing.T) {
+	// only node pages have an lsn; any other page is redone, even if what's
+	// on disk happens to look like a newer node page
+	const pageSize = 128
+	data, log := &memFile{}, &memFile{}
+	opts := Options{PageSize: pageSize, WAL: log}
+	tree, err := Open(3, data, opts, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tree.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	p, _ := page.NewPage(pageSize)
+	p.Header.LSN = 1000
+	stale, err := page.NewCodec(p).Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data.WriteAt(stale, 2*pageSize)
+
+	image := make([]byte, pageSize)
+	copy(image, []byte{0, 0, 0, 3, 'a', 'b', 'c'})
+	w := NewWAL(log)
+	if err := w.Append(walRecord{typ: recordPage, lsn: 1, page: 2, image: image}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Append(walRecord{typ: recordCommit, lsn: 2}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Open(3, data, opts, io.Discard); err != nil {
+		t.Fatal(err)
+	}
+	if got := data.b[2*pageSize : 3*pageSize]; !bytes.Equal(got, image) {
+		t.Fatalf("expected page 2 to be redone; got %v", got)
+	}
+}
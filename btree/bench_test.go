@@ -0,0 +1,82 @@
+package btree
+
+import (
+	"fmt"
+	"io"
+	"math/rand"
+	"sync"
+	"testing"
+)
+
+// rwTree is the tree behind a single lock, which optimistic reads are
+// compared with
+type rwTree struct {
+	mu sync.RWMutex
+	T  *BTree
+}
+
+func (r *rwTree) search(key int) {
+	r.mu.RLock()
+	r.T.Search(r.T.Root, key)
+	r.mu.RUnlock()
+}
+
+func (r *rwTree) insert(key int) {
+	r.mu.Lock()
+	r.T.Insert(key)
+	r.mu.Unlock()
+}
+
+// BenchmarkSearch runs a read-heavy mix of searches and inserts, spread over a
+// number of goroutines
+func BenchmarkSearch(b *testing.B) {
+	for _, g := range []int{1, 2, 4, 8, 16, 32, 64} {
+		b.Run(fmt.Sprintf("olc/goroutines=%d", g), func(b *testing.B) {
+			tree := benchTree()
+			benchSearch(b, g,
+				func(key int) { tree.Search(tree.Root, key) },
+				tree.Insert,
+			)
+		})
+		b.Run(fmt.Sprintf("rwmutex/goroutines=%d", g), func(b *testing.B) {
+			tree := &rwTree{T: benchTree()}
+			benchSearch(b, g, tree.search, tree.insert)
+		})
+	}
+}
+
+func benchTree() *BTree {
+	const size = 100_000
+	tree := New(16, io.Discard)
+	tree.dbg = false
+	for _, k := range rand.New(rand.NewSource(1)).Perm(size) {
+		tree.Insert(2 * k)
+	}
+	return tree
+}
+
+// benchSearch splits b.N operations over g goroutines. One in a hundred is an
+// insert.
+func benchSearch(b *testing.B, g int, search, insert func(key int)) {
+	var wg sync.WaitGroup
+	b.ResetTimer()
+	for i := range g {
+		ops := b.N / g
+		if i < b.N%g {
+			ops++
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rng := rand.New(rand.NewSource(int64(i)))
+			for range ops {
+				if key := rng.Intn(400_000); key%100 == 1 {
+					insert(key)
+				} else {
+					search(key)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -6,6 +6,8 @@ import (
 	"log/slog"
 	"slices"
 	"strings"
+	"sync"
+	"sync/atomic"
 )
 
 type BTree struct {
@@ -14,6 +16,9 @@ type BTree struct {
 	Root  *Node
 	stats Stats
 	dbg   bool
+
+	mu  sync.Mutex // serializes Insert and Delete; see olc.go
+	gen uint64     // bumped by Snapshot; see snapshot.go
 }
 
 // Keep statistics about read / write access
@@ -82,6 +87,7 @@ func FromString(n int, input string, w io.Writer) *BTree {
 	}
 
 	T.Root = root
+	T.WalkNodes(root, (*Node).publish)
 	T.validate()
 	return T
 }
@@ -94,6 +100,7 @@ func New(n int, w io.Writer) *BTree {
 	}
 	x := b.allocate()
 	x.Leaf = true
+	x.publish()
 	b.write(x)
 	b.Root = x
 	return b
@@ -101,10 +108,10 @@ func New(n int, w io.Writer) *BTree {
 
 func (T *BTree) allocate() *Node {
 	T.log.Debug("Allocate-Node")
-	return &Node{}
+	return &Node{gen: T.gen}
 }
 func (T *BTree) read(n *Node, i int) *Node {
-	if len(n.Children) < i-1 || i < 0 {
+	if i < 0 || i >= len(n.Children) {
 		return nil
 	}
 	c := n.Children[i]
@@ -149,22 +156,28 @@ func (T *BTree) validate() {
 // x.Children[i] is assumed full; x is assumed non-full. We split the child and
 // put the median key into x
 func (T *BTree) SplitChild(x *Node, i int) int {
-	y := T.read(x, i)
+	y := T.writable(x, i)
 	z := T.allocate()
 	z.Leaf = y.Leaf
+	x.lock()
+	y.lock()
 
 	medianIndex := len(y.Keys) / 2
 	key := y.Keys[medianIndex]
-	z.Keys = y.Keys[medianIndex+1:]
+	// y and z must not share backing arrays, or inserting into y overwrites z
+	z.Keys = slices.Clone(y.Keys[medianIndex+1:])
 	if !y.Leaf && len(y.Children) > 0 {
-		z.Children = y.Children[medianIndex+1:]
-		y.Children = y.Children[:medianIndex+1]
+		z.Children = slices.Clone(y.Children[medianIndex+1:])
+		y.Children = slices.Clip(y.Children[:medianIndex+1])
 	}
 
-	y.Keys = y.Keys[:medianIndex]
+	y.Keys = slices.Clip(y.Keys[:medianIndex])
 
 	x.Keys = slices.Insert(x.Keys, i, key)
 	x.Children = slices.Insert(x.Children, i+1, z)
+	z.publish()
+	x.unlock()
+	y.unlock()
 
 	T.write(x)
 	T.write(y)
@@ -189,6 +202,8 @@ func (T *BTree) full(x *Node) bool     { return len(x.Keys) == 2*T.n-1 }
 func (T *BTree) starving(x *Node) bool { return len(x.Keys) == T.n-1 } // bad name, TODO
 
 func (T *BTree) Insert(key int) {
+	T.mu.Lock()
+	defer T.mu.Unlock()
 	x := T.Root
 	if T.full(T.Root) {
 		x = T.splitRoot()
@@ -198,6 +213,8 @@ func (T *BTree) Insert(key int) {
 }
 
 func (T *BTree) Delete(key int) {
+	T.mu.Lock()
+	defer T.mu.Unlock()
 	T.delete(T.Root, key)
 	T.validate()
 }
@@ -217,72 +234,99 @@ func (T *BTree) delete(x *Node, key int) {
 	if k == key {
 		if x.Leaf {
 			// case 1: leaf
+			x.lock()
 			x.Keys = slices.Delete(x.Keys, i, i+1)
+			x.unlock()
 			return
 		}
 
-		if leaf, j := T.predecessor(x, i); len(leaf.Keys) >= T.n {
-			// case 2a; steal from predecessor
-			x.Keys[i] = leaf.popKey(j)
-		} else if leaf, j := T.successor(x, i); len(leaf.Keys) >= T.n {
-			// case 2b: steal from successor
-			x.Keys[j] = leaf.popKey(j)
+		if y := T.read(x, i); !T.starving(y) {
+			// case 2a: the predecessor takes the place of key, and is
+			// deleted from the child before it
+			leaf, j := T.predecessor(x, i)
+			pred := leaf.Keys[j]
+			y = T.writable(x, i)
+			x.lock()
+			x.Keys[i] = pred
+			x.unlock()
+			T.delete(y, pred)
+		} else if z := T.read(x, i+1); !T.starving(z) {
+			// case 2b: the same with the successor, from the child after
+			leaf, j := T.successor(x, i)
+			succ := leaf.Keys[j]
+			z = T.writable(x, i+1)
+			x.lock()
+			x.Keys[i] = succ
+			x.unlock()
+			T.delete(z, succ)
 		} else {
-			// case 2c: merge into left child
+			// case 2c: both children are starving, so they're merged
+			// around key, which is then deleted from the merged node
 			y := T.merge(x, i)
 			T.delete(y, key)
 		}
 		return
 	}
 
-	// not found in this node, so we either go left or right
-	var c *Node
+	// not found in this node, so we go down to child ci
+	ci := i
 	if key > k {
-		c = T.read(x, len(x.Keys)) // last child
-	} else {
-		c = T.read(x, i)
+		ci = len(x.Keys) // last child
 	}
+	c := T.writable(x, ci)
 
 	if T.starving(c) {
-		var left, right *Node
-		var takenkey int // sibling's key that we've taken
-		var child *Node  // sibling's child
-
-		// case 3a
-		if right = T.read(x, i+1); right != nil && !T.starving(right) {
-			// take leftmost child from right sibling. Move key over to x,
-			// and x yields a key down to the child. The sibling child gets
-			// adopted by c.
-			takenkey, child = right.popKeyLeft(0)
-		} else if left = T.read(x, i); left != nil && !T.starving(left) {
-			takenkey, child = left.popKeyRight(len(left.Keys) - 1)
-		} else {
-			// case 3b
-			// both siblings are starving; merge one of them, and carry on
-			if !(left != nil && T.starving(left) && right != nil && T.starving(right)) {
-				panic("Expected both siblings to starve")
+		// case 3a: c takes a key from a sibling that can spare one, through
+		// the separator in x. The sibling's child next to c is adopted.
+		if right := T.read(x, ci+1); right != nil && !T.starving(right) {
+			right = T.writable(x, ci+1)
+			x.lock()
+			c.lock()
+			right.lock()
+			takenkey, child := right.popKeyLeft(0)
+			c.Keys = append(c.Keys, x.swap(ci, takenkey))
+			if !c.Leaf {
+				c.Children = append(c.Children, child)
 			}
-			T.merge(x, i) // merge with right, so c is still the same
-			T.delete(c, key)
-			return
-			// T.delete(c,
-		}
-		keyToChild := x.swap(i, takenkey)
-		j := c.indexFor(keyToChild)
-		c.Keys = slices.Insert(c.Keys, j, keyToChild)
-		if !c.Leaf {
-			c.Children = slices.Insert(c.Children, j, child)
+			x.unlock()
+			c.unlock()
+			right.unlock()
+		} else if left := T.read(x, ci-1); left != nil && !T.starving(left) {
+			left = T.writable(x, ci-1)
+			x.lock()
+			c.lock()
+			left.lock()
+			takenkey, child := left.popKeyRight(len(left.Keys) - 1)
+			c.Keys = slices.Insert(c.Keys, 0, x.swap(ci-1, takenkey))
+			if !c.Leaf {
+				c.Children = slices.Insert(c.Children, 0, child)
+			}
+			x.unlock()
+			c.unlock()
+			left.unlock()
+		} else if right != nil {
+			// case 3b: the siblings are starving too, so c is merged with
+			// one of them. With the right one, c keeps the keys it had,
+			// unless it moved into the root.
+			c = T.merge(x, ci)
+		} else {
+			c = T.merge(x, ci-1)
 		}
 	}
 	T.delete(c, key)
-
 }
 
 // merge the two children located next to key at index i. The result gets
-// merged into the left child. x loses a key, as well.
+// merged into the left child. x loses a key, as well. The node with the
+// merged keys is returned; that's x if it's the root and became empty.
 func (T *BTree) merge(x *Node, i int) *Node {
-	y := T.read(x, i)   // left child
-	z := T.read(x, i+1) // right child
+	y := T.writable(x, i) // left child
+	z := T.read(x, i+1)   // right child
+	x.lock()
+	y.lock()
+	if T.owns(z) {
+		z.lock()
+	}
 	key := x.Keys[i]
 	x.Keys = slices.Delete(x.Keys, i, i+1)
 	x.Children = slices.Delete(x.Children, i+1, i+2) // remove z
@@ -294,11 +338,17 @@ func (T *BTree) merge(x *Node, i int) *Node {
 		y.Children = append(y.Children, z.Children...)
 	}
 
+	// z is gone, and stays locked so readers that still have it start over. If
+	// a snapshot has it, it's left alone.
 	if len(x.Keys) == 0 {
-		// Congrats, new root
-		T.Root = y
-	}
-
+		// Congrats, new root. It stays the same node, so y's keys and
+		// children move up into it, and y is gone too.
+		x.Leaf, x.Keys, x.Children = y.Leaf, y.Keys, y.Children
+		x.unlock()
+		return x
+	}
+	x.unlock()
+	y.unlock()
 	return y
 }
 
@@ -325,11 +375,13 @@ func (T *BTree) insertNonFull(x *Node, key int) {
 	i := x.indexFor(key)
 
 	if x.Leaf {
+		x.lock()
 		x.Keys = slices.Insert(x.Keys, i, key)
+		x.unlock()
 		return
 	}
 	// else it's not a leaf, so we check if it's full or not
-	c := T.read(x, i)
+	c := T.writable(x, i)
 	if T.full(c) {
 		med := T.SplitChild(x, i)
 		if key > med {
@@ -339,38 +391,20 @@ func (T *BTree) insertNonFull(x *Node, key int) {
 	T.insertNonFull(c, key)
 }
 
-// returns the new root
+// returns the root, which is split. The root stays the same node, so its keys
+// and children move down into a new child first.
 func (T *BTree) splitRoot() *Node {
-	s := T.allocate()
-	// s.Leaf = false
-	s.Children = []*Node{T.Root}
-	T.Root = s
+	s := T.Root
+	c := T.allocate()
+	s.lock()
+	c.Leaf, c.Keys, c.Children = s.Leaf, s.Keys, s.Children
+	c.publish()
+	s.Leaf, s.Keys, s.Children = false, nil, []*Node{c}
+	s.unlock()
 	T.SplitChild(s, 0)
-	s.Leaf = false
 	return s
 }
 
-func (T *BTree) Search(n *Node, key int) (*Node, int) {
-	for i, k := range n.Keys {
-		if k == key {
-			return n, i
-		} else if k > key {
-			if n.Leaf {
-				return nil, 0
-			}
-			// return b.sea
-			// c := n.Children[i] // disk read
-			c := T.read(n, i)
-			return T.Search(c, key)
-		}
-	}
-	if n.Leaf {
-		return nil, 0
-	}
-	c := n.Children[len(n.Keys)] // disk read here
-	return T.Search(c, key)
-}
-
 func (T *BTree) WalkNodes(n *Node, f func(n *Node)) {
 	if n == nil {
 		return
@@ -409,17 +443,12 @@ type Node struct {
 	Leaf     bool
 	Keys     []int
 	Children []*Node
-}
 
-// removes and returns the key at index i. It panics if the node is not a leaf
-func (n *Node) popKey(i int) int {
-	if !n.Leaf {
-		panic("popKey: Node is not a leaf")
-	}
-	key := n.Keys[i]
-	n.Keys = slices.Delete(n.Keys, i, i+1)
-	return key
+	version  atomic.Uint64            // odd while the node changes; see olc.go
+	contents atomic.Pointer[contents] // what Search reads; see olc.go
+	gen      uint64                   // of the tree that made it; see snapshot.go
 }
+
 func (n *Node) popKeyLeft(i int) (key int, child *Node) {
 	key = n.Keys[i]
 	n.Keys = slices.Delete(n.Keys, i, i+1)
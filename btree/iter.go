@@ -0,0 +1,74 @@
+package btree
+
+import (
+	"iter"
+	"math"
+	"slices"
+)
+
+// The iterators below yield every key along with the node that holds it.
+// Ranges are half-open, like [lo, hi).
+
+// All yields every key in ascending order
+func (T *BTree) All() iter.Seq2[int, *Node] {
+	return T.Ascend(math.MinInt)
+}
+
+// Ascend yields the keys >= from in ascending order
+func (T *BTree) Ascend(from int) iter.Seq2[int, *Node] {
+	return func(yield func(int, *Node) bool) {
+		T.ascend(T.Root, from, yield)
+	}
+}
+
+// Descend yields the keys <= from in descending order
+func (T *BTree) Descend(from int) iter.Seq2[int, *Node] {
+	return func(yield func(int, *Node) bool) {
+		T.descend(T.Root, from, yield)
+	}
+}
+
+// Between yields the keys in [lo, hi) in ascending order
+func (T *BTree) Between(lo, hi int) iter.Seq2[int, *Node] {
+	return func(yield func(int, *Node) bool) {
+		T.ascend(T.Root, lo, func(k int, n *Node) bool {
+			return k < hi && yield(k, n)
+		})
+	}
+}
+
+// ascend visits the keys >= lo in the subtree of n, and returns false once
+// yield does
+func (T *BTree) ascend(n *Node, lo int, yield func(int, *Node) bool) bool {
+	if n == nil {
+		return true
+	}
+	// children left of the first key >= lo only hold smaller keys
+	i, _ := slices.BinarySearch(n.Keys, lo)
+	for ; i <= len(n.Keys); i++ {
+		if !n.Leaf && !T.ascend(T.read(n, i), lo, yield) {
+			return false
+		}
+		if i < len(n.Keys) && !yield(n.Keys[i], n) {
+			return false
+		}
+	}
+	return true
+}
+
+// descend visits the keys <= hi in the subtree of n, from the largest
+func (T *BTree) descend(n *Node, hi int, yield func(int, *Node) bool) bool {
+	if n == nil {
+		return true
+	}
+	j := n.indexFor(hi) // keys before j are <= hi
+	for i := j; i >= 0; i-- {
+		if i < j && !yield(n.Keys[i], n) {
+			return false
+		}
+		if !n.Leaf && !T.descend(T.read(n, i), hi, yield) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,96 @@
+package btree
+
+import (
+	"io"
+	"iter"
+	"math"
+	"math/rand"
+	"slices"
+	"testing"
+)
+
+func keysOf(seq iter.Seq2[int, *Node]) []int {
+	var res []int
+	for k, n := range seq {
+		if !slices.Contains(n.Keys, k) {
+			panic("key is not in its node")
+		}
+		res = append(res, k)
+	}
+	return res
+}
+
+// With a minimum degree of 2, 200 keys make a tree of several levels, so the
+// iterators go in and out of internal nodes, whose keys come between those
+// of their children
+func TestIterators(t *testing.T) {
+	T := New(2, io.Discard)
+	rng := rand.New(rand.NewSource(1))
+	for _, k := range rng.Perm(200) {
+		T.Insert(2 * k)
+	}
+	if n := T.Root.Children[0]; n.Leaf || n.Children[0].Leaf {
+		t.Fatalf("want at least 3 levels, got %s", T.String(T.Root))
+	}
+	model := T.Keys()
+	between := func(lo, hi int) []int {
+		var res []int
+		for _, k := range model {
+			if lo <= k && k < hi {
+				res = append(res, k)
+			}
+		}
+		return res
+	}
+
+	if got := keysOf(T.All()); !slices.Equal(got, model) {
+		t.Fatalf("All: got %v, want %v", got, model)
+	}
+	for range 100 {
+		lo, hi := rng.Intn(410)-5, rng.Intn(410)-5
+		if got, want := keysOf(T.Ascend(lo)), between(lo, math.MaxInt); !slices.Equal(got, want) {
+			t.Fatalf("Ascend(%d): got %v, want %v", lo, got, want)
+		}
+		want := between(math.MinInt, hi+1)
+		slices.Reverse(want)
+		if got := keysOf(T.Descend(hi)); !slices.Equal(got, want) {
+			t.Fatalf("Descend(%d): got %v, want %v", hi, got, want)
+		}
+		if got, want := keysOf(T.Between(lo, hi)), between(lo, hi); !slices.Equal(got, want) {
+			t.Fatalf("Between(%d, %d): got %v, want %v", lo, hi, got, want)
+		}
+	}
+	if got := keysOf(New(2, io.Discard).All()); got != nil {
+		t.Fatalf("empty tree: got %v", got)
+	}
+}
+
+// Stopping a loop early stops the iterator, also when it's in an internal
+// node
+func TestIteratorsBreak(t *testing.T) {
+	T := FromString(2, "(4(2(1)(3))(6(5)(78)))", io.Discard)
+	cases := []struct {
+		desc string
+		seq  iter.Seq2[int, *Node]
+		want []int
+	}{
+		{"all", T.All(), []int{1, 2, 3, 4}},
+		{"ascend", T.Ascend(2), []int{2, 3, 4, 5}},
+		{"descend", T.Descend(7), []int{7, 6, 5, 4}},
+		{"between", T.Between(3, 8), []int{3, 4, 5, 6}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.desc, func(t *testing.T) {
+			var got []int
+			for k := range tc.seq {
+				got = append(got, k)
+				if len(got) == 4 {
+					break
+				}
+			}
+			if !slices.Equal(got, tc.want) {
+				t.Fatalf("got %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
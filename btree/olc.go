@@ -0,0 +1,107 @@
+package btree
+
+import (
+	"runtime"
+	"slices"
+)
+
+// Optimistic lock coupling
+//
+// Search takes no locks. Every node has a version, which writers bump before
+// and after they change it, so it's odd while the node changes. A reader
+// notes the version of a node, reads it, and checks that the version is the
+// same afterwards; if not, what it read may be garbage and it starts over
+// from the root. Before it moves to a child, it notes the child's version and
+// checks the parent once more, so the child was still the right one to go to.
+//
+// Search doesn't read the fields of a node, which the writer changes in
+// place. It reads the node's contents: a copy of the fields that's never
+// changed, and that the writer replaces through an atomic pointer when it
+// unlocks the node. The version is bumped after that, so contents read
+// between readLock and a successful validate are those of the version. A node
+// the writer makes is published before any node points to it.
+//
+// Writers are serialized by a mutex. A node that's no longer in the tree
+// after a merge is left locked, so readers that still have it start over,
+// unless a snapshot has it. The root is never replaced, so a reader can
+// always start over from it.
+
+// contents is what Search reads of a node
+type contents struct {
+	leaf     bool
+	keys     []int
+	children []*Node
+}
+
+// lock marks n as changing. Only the writer holding T.mu calls it.
+func (n *Node) lock() { n.version.Add(1) }
+
+// unlock publishes the changes to n, and marks them as done
+func (n *Node) unlock() {
+	n.publish()
+	n.version.Add(1)
+}
+
+// publish makes the fields of n what Search reads
+func (n *Node) publish() {
+	n.contents.Store(&contents{leaf: n.Leaf, keys: slices.Clone(n.Keys), children: slices.Clone(n.Children)})
+}
+
+// load returns what Search reads of n. Nodes made outside the tree, as tests
+// do, are published the first time they're read.
+func (n *Node) load() *contents {
+	if c := n.contents.Load(); c != nil {
+		return c
+	}
+	n.contents.CompareAndSwap(nil, &contents{leaf: n.Leaf, keys: n.Keys, children: n.Children})
+	return n.contents.Load()
+}
+
+// readLock returns the version of n, and false if n is changing
+func (n *Node) readLock() (uint64, bool) {
+	v := n.version.Load()
+	return v, v%2 == 0
+}
+
+// validate reports whether n is unchanged since readLock returned v
+func (n *Node) validate(v uint64) bool { return n.version.Load() == v }
+
+// Search returns the node with key and its index, or nil if there's no such
+// key. n is where the search starts, and should be the root. It is safe to
+// call while the tree is being changed.
+func (T *BTree) Search(n *Node, key int) (*Node, int) {
+	for {
+		if x, i, ok := T.search(n, key); ok {
+			return x, i
+		}
+		runtime.Gosched()
+	}
+}
+
+// search is one optimistic attempt at Search. It reports false if a node
+// changed while it was read.
+func (T *BTree) search(n *Node, key int) (*Node, int, bool) {
+	v, ok := n.readLock()
+	if !ok {
+		return nil, 0, false
+	}
+	for {
+		s := n.load()
+		if !n.validate(v) {
+			return nil, 0, false
+		}
+		i, found := slices.BinarySearch(s.keys, key)
+		if found || s.leaf {
+			if !found {
+				return nil, 0, true
+			}
+			return n, i, true
+		}
+		c := s.children[i]
+		cv, ok := c.readLock()
+		if !ok || !n.validate(v) {
+			return nil, 0, false
+		}
+		n, v = c, cv
+	}
+}
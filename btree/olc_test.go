@@ -0,0 +1,89 @@
+package btree
+
+import (
+	"io"
+	"math/rand"
+	"sync"
+	"testing"
+)
+
+func TestVersions(t *testing.T) {
+	tree := FromString(2, "(3(12)(456))", io.Discard)
+	root, left, right := tree.Root, tree.Root.Children[0], tree.Root.Children[1]
+
+	tree.SplitChild(root, 1)
+	for _, n := range []*Node{root, right} {
+		if v, ok := n.readLock(); !ok || v != 2 {
+			t.Errorf("node %s: want version 2 after split, got %d", n, v)
+		}
+	}
+	if v, _ := left.readLock(); v != 0 {
+		t.Errorf("node %s was not changed, but has version %d", left, v)
+	}
+
+	// the root stays the same node when the tree shrinks
+	tree = FromString(2, "(2(1)(3))", io.Discard)
+	root, left, right = tree.Root, tree.Root.Children[0], tree.Root.Children[1]
+	if got := tree.merge(root, 0); got != root {
+		t.Fatalf("merge into empty root returned %s", got)
+	}
+	expectTree(t, tree, "(123)")
+	for _, n := range []*Node{left, right} {
+		if _, ok := n.readLock(); ok {
+			t.Errorf("node %s was merged away, but is not locked", n)
+		}
+	}
+	if _, ok := root.readLock(); !ok {
+		t.Errorf("root is still locked")
+	}
+}
+
+func TestSearchConcurrent(t *testing.T) {
+	tree := New(3, io.Discard)
+	// validation walks the whole tree, which is not safe while it changes
+	tree.dbg = false
+
+	// even keys are there from the start; the writer inserts odd keys
+	const size = 20000
+	for _, k := range rand.New(rand.NewSource(1)).Perm(size / 2) {
+		tree.Insert(2 * k)
+	}
+
+	var wg sync.WaitGroup
+	done := make(chan struct{})
+	errs := make(chan string, 8)
+	for r := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rng := rand.New(rand.NewSource(int64(r)))
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				k := rng.Intn(size)
+				if n, _ := tree.Search(tree.Root, k); k%2 == 0 && n == nil {
+					errs <- "Search missed a key that was there from the start"
+					return
+				}
+			}
+		}()
+	}
+	for _, k := range rand.New(rand.NewSource(2)).Perm(size / 2) {
+		tree.Insert(2*k + 1)
+	}
+	close(done)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+
+	for k := range size {
+		if n, _ := tree.Search(tree.Root, k); n == nil {
+			t.Fatalf("key %d is missing", k)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package btree
+
+import (
+	"iter"
+	"slices"
+)
+
+// Snapshots
+//
+// A snapshot shares nodes with the tree. Every node has the generation of the
+// tree when it was made, and Snapshot bumps the tree's generation, so all the
+// nodes there are at that point belong to the snapshot too. Insert and Delete
+// only change nodes of the current generation; a node of an older one is
+// copied first, and its parent is pointed at the copy. Changing a node means
+// changing the path to it from the root, so whole paths are copied.
+//
+// The root is the exception. It has to stay the same node (see olc.go), so
+// the snapshot gets a copy of it instead.
+//
+// Nothing keeps track of snapshots; the nodes that only a snapshot has are
+// garbage once the snapshot is.
+
+// Snapshot is a view of a tree at the time Snapshot was called, which later
+// changes to the tree don't affect
+type Snapshot struct {
+	t *BTree
+}
+
+// Snapshot returns a view of the tree as it is now
+func (T *BTree) Snapshot() *Snapshot {
+	T.mu.Lock()
+	defer T.mu.Unlock()
+
+	root := &Node{
+		Leaf:     T.Root.Leaf,
+		Keys:     slices.Clone(T.Root.Keys),
+		Children: slices.Clone(T.Root.Children),
+		gen:      T.gen,
+	}
+	root.publish()
+	T.gen++
+	T.Root.gen = T.gen
+	return &Snapshot{t: &BTree{n: T.n, log: T.log, Root: root}}
+}
+
+// Search returns the node with key and its index, or nil if there's no such
+// key
+func (s *Snapshot) Search(key int) (*Node, int) { return s.t.Search(s.t.Root, key) }
+func (s *Snapshot) Walk(f func(key int))        { s.t.Walk(s.t.Root, f) }
+func (s *Snapshot) Keys() []int                 { return s.t.Keys() }
+func (s *Snapshot) All() iter.Seq2[int, *Node]  { return s.t.All() }
+
+// owns reports whether n can be changed in place, which it can unless a
+// snapshot has it
+func (T *BTree) owns(n *Node) bool { return n.gen == T.gen }
+
+// writable returns child i of x, after copying it if a snapshot has it. x must
+// be writable.
+func (T *BTree) writable(x *Node, i int) *Node {
+	c := T.read(x, i)
+	if T.owns(c) {
+		return c
+	}
+	d := T.allocate()
+	d.Leaf = c.Leaf
+	d.Keys = slices.Clone(c.Keys)
+	d.Children = slices.Clone(c.Children)
+	d.publish()
+	x.lock()
+	x.Children[i] = d
+	x.unlock()
+	T.write(x)
+	return d
+}
@@ -0,0 +1,136 @@
+package btree
+
+import (
+	"fmt"
+	"io"
+	"math/rand"
+	"runtime"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestSnapshot(t *testing.T) {
+	tree := New(2, io.Discard)
+	keys := rand.New(rand.NewSource(1)).Perm(200)
+	for _, k := range keys[:100] {
+		tree.Insert(k)
+	}
+	s := tree.Snapshot()
+	for _, k := range keys[100:] {
+		tree.Insert(k)
+	}
+
+	if got, want := s.Keys(), slices.Sorted(slices.Values(keys[:100])); !slices.Equal(got, want) {
+		t.Fatalf("snapshot changed;\nwant= %v\ngot = %v", want, got)
+	}
+	if got := tree.Keys(); len(got) != 200 {
+		t.Fatalf("want 200 keys in the tree, got %d", len(got))
+	}
+	for _, k := range keys {
+		n, _ := s.Search(k)
+		if inSnapshot := slices.Contains(keys[:100], k); (n != nil) != inSnapshot {
+			t.Errorf("Search(%d) in snapshot: found=%t, want %t", k, n != nil, inSnapshot)
+		}
+	}
+}
+
+func TestSnapshotShares(t *testing.T) {
+	tree := FromString(2, "(4(2(1)(3))(6(5)(7)))", io.Discard)
+	s := tree.Snapshot()
+	tree.Insert(8)
+
+	expectTree(t, tree, "(4(2(1)(3))(6(5)(78)))")
+	expectTree(t, s.t, "(4(2(1)(3))(6(5)(7)))")
+	if tree.Root.Children[0] != s.t.Root.Children[0] {
+		t.Errorf("left subtree was not changed, but was copied")
+	}
+	if tree.Root.Children[1] == s.t.Root.Children[1] {
+		t.Errorf("right subtree was changed in place")
+	}
+}
+
+// Random deletions until the tree is empty, with snapshots along the way
+// that must not change
+func TestSnapshotDeleteRandom(t *testing.T) {
+	for seed := range 20 {
+		t.Run(fmt.Sprintf("seed=%d", seed), func(t *testing.T) {
+			rng := rand.New(rand.NewSource(int64(seed)))
+			tree := New(2, io.Discard)
+			keys := rng.Perm(100)[:60]
+			for _, k := range keys {
+				tree.Insert(k)
+			}
+			rng.Shuffle(len(keys), func(i, j int) { keys[i], keys[j] = keys[j], keys[i] })
+
+			var snapshots []*Snapshot
+			var wants [][]int
+			for i, k := range keys {
+				if i%10 == 0 {
+					snapshots = append(snapshots, tree.Snapshot())
+					wants = append(wants, slices.Sorted(slices.Values(keys[i:])))
+				}
+				tree.Delete(k)
+				if n, _ := tree.Search(tree.Root, k); n != nil {
+					t.Fatalf("Search(%d) found a deleted key", k)
+				}
+			}
+			if got := tree.Keys(); len(got) != 0 {
+				t.Fatalf("keys left after deleting all: %v", got)
+			}
+			for i, s := range snapshots {
+				if got := s.Keys(); !slices.Equal(got, wants[i]) {
+					t.Fatalf("snapshot %d changed;\nwant= %v\ngot = %v", i, wants[i], got)
+				}
+			}
+		})
+	}
+}
+
+// The deletions of TestDelete/Cormen, with a snapshot before each
+func TestSnapshotDelete(t *testing.T) {
+	steps := []struct {
+		key  int
+		want string
+	}{
+		{key: 'F', want: "(P(CGM(AB)(DE)(JKL)(NO))(TX(QRS)(UV)(YZ)))"},
+		{key: 'M', want: "(P(CGL(AB)(DE)(JK)(NO))(TX(QRS)(UV)(YZ)))"},
+		{key: 'G', want: "(P(CL(AB)(DEJK)(NO))(TX(QRS)(UV)(YZ)))"},
+		{key: 'D', want: "(CLPTX(AB)(EJK)(NO)(QRS)(UV)(YZ))"},
+		{key: 'B', want: "(ELPTX(AC)(JK)(NO)(QRS)(UV)(YZ))"},
+	}
+	input := "(P(CGM(AB)(DEF)(JKL)(NO))(TX(QRS)(UV)(YZ)))"
+	tree := FromString(3, input, io.Discard)
+	snapshots := []*Snapshot{tree.Snapshot()}
+	wants := []string{input}
+	for _, step := range steps {
+		tree.Delete(step.key)
+		expectTree(t, tree, step.want)
+		snapshots = append(snapshots, tree.Snapshot())
+		wants = append(wants, step.want)
+	}
+	for i, s := range snapshots {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			expectTree(t, s.t, wants[i])
+		})
+	}
+}
+
+func TestSnapshotRelease(t *testing.T) {
+	tree := New(2, io.Discard)
+	for k := range 100 {
+		tree.Insert(k)
+	}
+	released := make(chan struct{})
+	runtime.SetFinalizer(tree.Snapshot().t.Root, func(*Node) { close(released) })
+
+	for range 100 {
+		runtime.GC()
+		select {
+		case <-released:
+			return
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	t.Fatal("snapshot was not released")
+}
@@ -1,6 +1,9 @@
 package page
 
-import "encoding/binary"
+import (
+	"encoding/binary"
+	"math"
+)
 
 type CellType int
 
@@ -34,6 +37,10 @@ type Cell struct {
 
 	Value  []byte
 	PageID PageID
+
+	// First overflow page with the rest of Value, or 0 if the whole value is
+	// stored in the cell. See Spill.
+	Overflow PageID
 }
 
 func NewKeyCell(key string, ID PageID) Cell {
@@ -43,37 +50,63 @@ func NewValueCell(key string, value []byte) Cell {
 	return Cell{Type: CellTypeValue, Key: key, Value: value}
 }
 
+// Lengths are stored as uvarints. For value cells, the lowest bit of the
+// value length tells whether an overflow page id follows the value.
 func (c *Cell) DiskSize() int {
 	if c.Type == CellTypeKey {
 		// keylen, pageID, keydata
-		return 1 + 2 + len(c.Key)
+		return uvarintSize(uint64(len(c.Key))) + 2 + len(c.Key)
+	}
+	// keylen, valuelen, keydata, valuedata, overflow
+	n := uvarintSize(uint64(len(c.Key))) + uvarintSize(c.valueLen()) + len(c.Key) + len(c.Value)
+	if c.Overflow != 0 {
+		n += 2
+	}
+	return n
+}
+
+func (c *Cell) valueLen() uint64 {
+	n := uint64(len(c.Value)) << 1
+	if c.Overflow != 0 {
+		n |= 1
+	}
+	return n
+}
+
+// check returns an error if the cell can't be encoded
+func (c *Cell) check() error {
+	if c.Type != CellTypeKey && c.Type != CellTypeValue {
+		return ErrUnknownCellType
+	}
+	if c.DiskSize() > math.MaxUint16 {
+		return ErrOverflow
 	}
-	// keylen, valuelen, keydata, valuedata
-	return 1 + 1 + len(c.Key) + len(c.Value)
+	return nil
 }
 
 func (c *Cell) Write(b []byte) (n int, err error) {
-	b[n] = uint8(len(c.Key))
-	n++
+	if err := c.check(); err != nil {
+		return 0, err
+	}
+	if len(b) < c.DiskSize() {
+		return 0, ErrTruncated
+	}
+	n += binary.PutUvarint(b[n:], uint64(len(c.Key)))
 	if c.Type == CellTypeValue {
-		b[n] = uint8(len(c.Value))
-		n++
+		n += binary.PutUvarint(b[n:], c.valueLen())
 	} else {
 		binary.BigEndian.PutUint16(b[n:n+2], uint16(c.PageID))
-		n++
-		n++
-	}
-	for _, c := range c.Key {
-		b[n] = byte(c) // assume ascii
-		n++
+		n += 2
 	}
+	n += copy(b[n:], c.Key)
 	if c.Type == CellTypeValue {
-		for _, c := range c.Value {
-			b[n] = byte(c)
-			n++
+		n += copy(b[n:], c.Value)
+		if c.Overflow != 0 {
+			binary.BigEndian.PutUint16(b[n:n+2], uint16(c.Overflow))
+			n += 2
 		}
 	}
-	return n, err
+	return n, nil
 }
 
 // utility function, for testing
@@ -88,3 +121,69 @@ func (c *Cell) Bytes() []byte {
 	}
 	return b
 }
+
+// DecodeCell reads a cell of type t from the start of b, returning the cell
+// and the number of bytes consumed. It is the inverse of Cell.Write
+func DecodeCell(t CellType, b []byte) (Cell, int, error) {
+	if t != CellTypeKey && t != CellTypeValue {
+		return Cell{}, 0, ErrUnknownCellType
+	}
+	c := Cell{Type: t}
+	keylen, n, err := readUvarint(b)
+	if err != nil {
+		return Cell{}, 0, err
+	}
+	var valuelen uint64
+	if t == CellTypeValue {
+		v, m, err := readUvarint(b[n:])
+		if err != nil {
+			return Cell{}, 0, err
+		}
+		n += m
+		valuelen = v
+	} else {
+		if len(b) < n+2 {
+			return Cell{}, 0, ErrTruncated
+		}
+		c.PageID = PageID(binary.BigEndian.Uint16(b[n : n+2]))
+		n += 2
+	}
+	overflow := valuelen&1 == 1
+	valuelen >>= 1
+	if keylen > uint64(len(b)) || valuelen > uint64(len(b)) {
+		return Cell{}, 0, ErrTruncated
+	}
+	if len(b) < n+int(keylen)+int(valuelen) {
+		return Cell{}, 0, ErrTruncated
+	}
+	c.Key = string(b[n : n+int(keylen)])
+	n += int(keylen)
+	if t == CellTypeValue {
+		c.Value = make([]byte, valuelen)
+		n += copy(c.Value, b[n:n+int(valuelen)])
+		if overflow {
+			if len(b) < n+2 {
+				return Cell{}, 0, ErrTruncated
+			}
+			c.Overflow = PageID(binary.BigEndian.Uint16(b[n : n+2]))
+			n += 2
+		}
+	}
+	return c, n, nil
+}
+
+func uvarintSize(x uint64) int {
+	var b [binary.MaxVarintLen64]byte
+	return binary.PutUvarint(b[:], x)
+}
+
+func readUvarint(b []byte) (uint64, int, error) {
+	v, n := binary.Uvarint(b)
+	if n == 0 {
+		return 0, 0, ErrTruncated
+	}
+	if n < 0 {
+		return 0, 0, ErrOverflow
+	}
+	return v, n, nil
+}
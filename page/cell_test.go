@@ -13,13 +13,28 @@ func TestBytes(t *testing.T) {
 		{
 			desc: "KeyValue",
 			cell: NewValueCell("hi", []byte("world")),
-			want: []byte{2, 5, 'h', 'i', 'w', 'o', 'r', 'l', 'd'},
+			want: []byte{2, 5 << 1, 'h', 'i', 'w', 'o', 'r', 'l', 'd'},
 		},
 		{
 			desc: "Key",
 			cell: NewKeyCell("hi", 8),
 			want: []byte{2, 0x00, 0x08, 'h', 'i'},
 		},
+		{
+			desc: "UTF-8",
+			cell: NewKeyCell("blå", 8),
+			want: []byte{4, 0x00, 0x08, 'b', 'l', 0xc3, 0xa5},
+		},
+		{
+			desc: "Overflow",
+			cell: Cell{Type: CellTypeValue, Key: "k", Value: []byte("v"), Overflow: 0x0102},
+			want: []byte{1, 1<<1 | 1, 'k', 'v', 0x01, 0x02},
+		},
+		{
+			desc: "Long",
+			cell: NewValueCell("k", make([]byte, 200)),
+			want: append([]byte{1, 0x90, 0x03, 'k'}, make([]byte, 200)...),
+		},
 	}
 	for _, tc := range cases {
 		t.Run(tc.desc, func(t *testing.T) {
@@ -3,5 +3,10 @@ package page
 import "errors"
 
 var (
-	ErrNoSpace = errors.New("not enough remaining space")
+	ErrNoSpace         = errors.New("not enough remaining space")
+	ErrCellType        = errors.New("cell type does not match page")
+	ErrKeyExists       = errors.New("key already exists")
+	ErrTruncated       = errors.New("truncated input")
+	ErrUnknownCellType = errors.New("unknown cell type")
+	ErrOverflow        = errors.New("length overflows encoding")
 )
@@ -55,6 +55,8 @@ func NewFreeSlots(size int) *FreeSlots {
 	}
 }
 
+// Reserve finds the smallest free slot that fits size (best-fit) and hands out
+// the end of it. Returns nil if no slot is large enough.
 func (f *FreeSlots) Reserve(size CellSize) *slot {
 	var (
 		best  *slot
@@ -70,19 +72,15 @@ func (f *FreeSlots) Reserve(size CellSize) *slot {
 	}
 	var res *slot
 	if best != nil {
-		fmt.Printf("best is %s\n", best)
 		if n := best.size - size; n > 0 {
 			res = &slot{p: best.End().Sub(size), size: size}
 			best.size -= size
-			fmt.Printf("before return \n\t%s \n\t%s\n", res, best)
 		} else {
 			tmp := *best
 			res = &tmp
-			// bug here, we want to only give as little as necessary and keep rest
 			f.slots = slices.Delete(f.slots, index, index+1)
 		}
 	}
-	// ...
 	if res != nil {
 		f.yielded = append(f.yielded, res)
 	}
@@ -90,57 +88,58 @@ func (f *FreeSlots) Reserve(size CellSize) *slot {
 	return res
 }
 
+// reserveAt reserves exactly [p, p+size). Returns nil if any part of that
+// range is already taken
+func (f *FreeSlots) reserveAt(p CellPointer, size CellSize) *slot {
+	res := &slot{p: p, size: size}
+	for i, s := range f.slots {
+		if s.p > p || s.End() < res.End() {
+			continue
+		}
+		// split the free slot in (up to) two; what's left and right of us
+		left := slot{p: s.p, size: CellSize(p - s.p)}
+		right := slot{p: res.End(), size: CellSize(s.End() - res.End())}
+		f.slots = slices.Delete(f.slots, i, i+1)
+		if right.size > 0 {
+			f.slots = slices.Insert(f.slots, i, right)
+		}
+		if left.size > 0 {
+			f.slots = slices.Insert(f.slots, i, left)
+		}
+		f.yielded = append(f.yielded, res)
+		return res
+	}
+	return nil
+}
+
+// Free returns the slot to the free list, coalescing it with its neighbours
 func (f *FreeSlots) Free(sl *slot) {
-	// are we next to adjacent free slots? In that case, we extend them.
-	// Otherwise, we just register
 	p := sl.p
 	size := sl.size
 
-	if true {
-		for i, sl := range f.yielded {
-			if sl.p == p && sl.size == size {
-				f.yielded = slices.Delete(f.yielded, i, i+1)
-				break
-			}
+	for i, sl := range f.yielded {
+		if sl.p == p && sl.size == size {
+			f.yielded = slices.Delete(f.yielded, i, i+1)
+			break
 		}
-		// take back from yielded
-		fmt.Printf("Free: got new slot %s\n", sl)
-		// sl.debugValue = 0
-		newSlot := slot{p: p, size: size}
-
-		f.slots = append(f.slots, newSlot)
-		slices.SortFunc(f.slots, func(i, j slot) int {
-			if i.p < j.p {
-				return -1
-			}
-			if i.p > j.p {
-				return 1
-			}
-			return 0
-		})
-		for i := 0; i < len(f.slots)-1; i++ {
-			if f.slots[i].End().AdjacentTo(f.slots[i+1].p) {
-				f.slots[i].size += f.slots[i+1].size
-				f.slots = slices.Delete(f.slots, i+1, i+2)
-			}
-		}
-
-		return
 	}
 
-	for i, slot := range f.slots {
-		if p >= slot.p {
-			if slot.AdjacentTo(p) {
-				slot.size += size
-				if i+1 < len(f.slots)-1 {
-					right := f.slots[i+1]
-					if right.AdjacentTo(slot.End()) {
-						slot.size += right.size
-						f.slots = slices.Delete(f.slots, i+1, i+2)
-					}
-				}
-				return
-			}
+	f.slots = append(f.slots, slot{p: p, size: size})
+	slices.SortFunc(f.slots, func(i, j slot) int {
+		if i.p < j.p {
+			return -1
+		}
+		if i.p > j.p {
+			return 1
+		}
+		return 0
+	})
+	for i := 0; i < len(f.slots)-1; {
+		if f.slots[i].End() == f.slots[i+1].p {
+			f.slots[i].size += f.slots[i+1].size
+			f.slots = slices.Delete(f.slots, i+1, i+2)
+		} else {
+			i++
 		}
 	}
 }
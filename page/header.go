@@ -1,14 +1,95 @@
 package page
 
+import (
+	"encoding/binary"
+	"fmt"
+)
+
 type Header struct {
 	PageSize uint16   // page size
 	CType    CellType // homogenous cell type within a page
+
+	// Right is a page to the right of all cells, or 0 if there's none. In a
+	// tree, it's typically the rightmost child or the right sibling.
+	Right PageID
+
+	LSN uint64 // log sequence number of the last change to the page
+
+	// Link is the next page on the same level, or 0 if there's none, and
+	// HighKey is an upper bound on the keys in and below the page. They're
+	// used by B-link trees, and the high key is only stored with a link.
+	Link    PageID
+	HighKey string
 }
 
+// linkFlag is set in the cell type byte when the header has a link
+const linkFlag = 0x80
+
 func (p *Header) DiskSize() int {
-	return 3
+	if p.Link == 0 {
+		return 13
+	}
+	return 15 + uvarintSize(uint64(len(p.HighKey))) + len(p.HighKey)
+}
+
+// Write serializes the header into the start of b; pagesize, celltype, the
+// right page, then the lsn. A link is followed by the length of the high key,
+// and the high key.
+func (p *Header) Write(b []byte) (n int, err error) {
+	if len(b) < p.DiskSize() {
+		return 0, fmt.Errorf("header: buffer too small; want %d bytes, got %d", p.DiskSize(), len(b))
+	}
+	if p.CType < 0 || p.CType >= linkFlag {
+		return 0, ErrOverflow
+	}
+	binary.BigEndian.PutUint16(b[0:2], p.PageSize)
+	b[2] = uint8(p.CType)
+	binary.BigEndian.PutUint16(b[3:5], uint16(p.Right))
+	binary.BigEndian.PutUint64(b[5:13], p.LSN)
+	if p.Link != 0 {
+		b[2] |= linkFlag
+		binary.BigEndian.PutUint16(b[13:15], uint16(p.Link))
+		off := 15 + binary.PutUvarint(b[15:], uint64(len(p.HighKey)))
+		copy(b[off:], p.HighKey)
+	}
+	return p.DiskSize(), nil
+}
+
+func (p *Header) Bytes() []byte {
+	b := make([]byte, p.DiskSize())
+	if _, err := p.Write(b); err != nil {
+		panic(err)
+	}
+	return b
 }
 
-func (p *Header) Bytes(h Header) []byte {
-	return nil
+func decodeHeader(b []byte) (Header, int, error) {
+	var h Header
+	if len(b) < h.DiskSize() {
+		return h, 0, ErrTruncated
+	}
+	h.PageSize = binary.BigEndian.Uint16(b[0:2])
+	h.CType = CellType(b[2] &^ linkFlag)
+	if h.CType != CellTypeKey && h.CType != CellTypeValue {
+		return h, 0, ErrUnknownCellType
+	}
+	h.Right = PageID(binary.BigEndian.Uint16(b[3:5]))
+	h.LSN = binary.BigEndian.Uint64(b[5:13])
+	if b[2]&linkFlag == 0 {
+		return h, h.DiskSize(), nil
+	}
+	if len(b) < 15 {
+		return h, 0, ErrTruncated
+	}
+	h.Link = PageID(binary.BigEndian.Uint16(b[13:15]))
+	size, n, err := readUvarint(b[15:])
+	if err != nil {
+		return h, 0, err
+	}
+	n += 15
+	if uint64(len(b)-n) < size {
+		return h, 0, ErrTruncated
+	}
+	h.HighKey = string(b[n : n+int(size)])
+	return h, n + int(size), nil
 }
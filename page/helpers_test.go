@@ -1,6 +1,9 @@
 package page
 
-import "testing"
+import (
+	"strings"
+	"testing"
+)
 
 func expectBytesEq(t *testing.T, want, got []byte) {
 	t.Helper()
@@ -13,3 +16,36 @@ func expectBytesEq(t *testing.T, want, got []byte) {
 		}
 	}
 }
+
+func expectPageEq(t *testing.T, want, got *Page) {
+	t.Helper()
+	if want.Header != got.Header {
+		t.Fatalf("header mismatch: want=%+v, got=%+v", want.Header, got.Header)
+	}
+	if len(want.Cells) != len(got.Cells) || len(want.Offsets) != len(got.Offsets) {
+		t.Fatalf("cell count mismatch: want=%d, got=%d", len(want.Cells), len(got.Cells))
+	}
+	for i := range want.Cells {
+		if want.Offsets[i] != got.Offsets[i] {
+			t.Fatalf("offset %d mismatch: want=%d, got=%d", i, want.Offsets[i], got.Offsets[i])
+		}
+		expectCellEq(t, want.Cells[i], got.Cells[i])
+	}
+}
+
+func expectCellEq(t *testing.T, want, got Cell) {
+	t.Helper()
+	if want.Type != got.Type || want.Key != got.Key || want.PageID != got.PageID || want.Overflow != got.Overflow || string(want.Value) != string(got.Value) {
+		t.Fatalf("cell mismatch: want=%+v, got=%+v", want, got)
+	}
+}
+
+func splitKeys(s string) []string {
+	var res []string
+	for _, k := range strings.Split(s, ",") {
+		if k != "" {
+			res = append(res, k)
+		}
+	}
+	return res
+}
@@ -0,0 +1,148 @@
+package page
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// Values that are too large to be stored in a page are split; the first part
+// stays in the cell, and the rest goes to a chain of overflow pages. Each
+// overflow page looks like this:
+//
+//	| next PageID | length | data ... |
+//
+// where next is 0 for the last page in the chain. Page 0 is therefore never
+// used as an overflow page.
+
+const overflowHeaderSize = 4
+
+// Store reads and writes whole pages. It is where overflow pages live.
+type Store interface {
+	Allocate() (PageID, error)
+	Free(id PageID) error
+	ReadPage(id PageID) ([]byte, error)
+	WritePage(id PageID, b []byte) error
+}
+
+// MaxCellSize is the largest cell we'll store in a page of the given size
+// without spilling to overflow pages. It's chosen so at least four cells
+// fit in a page.
+func MaxCellSize(pageSize int) int {
+	return (pageSize-(&Header{}).DiskSize()-2)/4 - 2
+}
+
+// Spill moves the part of the value that does not fit in a page of the given
+// size to overflow pages. The returned cell is what should be stored in the
+// page. Cells that already fit are returned as is.
+func Spill(s Store, c Cell, pageSize int) (Cell, error) {
+	maxCell := MaxCellSize(pageSize)
+	if c.Type != CellTypeValue || c.DiskSize() <= maxCell {
+		return c, nil
+	}
+	if c.Overflow != 0 {
+		return c, fmt.Errorf("spill: cell %q has already spilled", c.Key)
+	}
+
+	// everything but the local part of the value; assume the value length
+	// takes as much space as it could
+	base := uvarintSize(uint64(len(c.Key))) + uvarintSize(uint64(maxCell)<<1|1) + len(c.Key) + 2
+	local := maxCell - base
+	if local < 0 {
+		return c, fmt.Errorf("spill: key of %d bytes is too large: %w", len(c.Key), ErrOverflow)
+	}
+	capacity := pageSize - overflowHeaderSize
+	if capacity <= 0 {
+		return c, fmt.Errorf("spill: page size %d too small: %w", pageSize, ErrOverflow)
+	}
+
+	var chunks [][]byte
+	for rest := c.Value[local:]; len(rest) > 0; {
+		n := min(len(rest), capacity)
+		chunks = append(chunks, rest[:n])
+		rest = rest[n:]
+	}
+
+	// write the chain back to front, so each page knows its successor
+	var next PageID
+	for i := len(chunks) - 1; i >= 0; i-- {
+		id, err := s.Allocate()
+		if err != nil {
+			return c, abandon(s, next, err)
+		}
+		if id == 0 {
+			return c, abandon(s, next, fmt.Errorf("spill: store allocated page 0"))
+		}
+		b := make([]byte, pageSize)
+		binary.BigEndian.PutUint16(b[0:2], uint16(next))
+		binary.BigEndian.PutUint16(b[2:4], uint16(len(chunks[i])))
+		copy(b[overflowHeaderSize:], chunks[i])
+		if err := s.WritePage(id, b); err != nil {
+			return c, abandon(s, next, errors.Join(err, s.Free(id)))
+		}
+		next = id
+	}
+
+	c.Value = c.Value[:local]
+	c.Overflow = next
+	return c, nil
+}
+
+// abandon frees the part of a chain that was written, starting at next, and
+// returns err along with any error from freeing it
+func abandon(s Store, next PageID, err error) error {
+	return errors.Join(err, FreeOverflow(s, Cell{Overflow: next}))
+}
+
+// Assemble is the inverse of Spill; it returns the cell with the whole value,
+// read back from the overflow pages.
+func Assemble(s Store, c Cell) (Cell, error) {
+	if c.Overflow == 0 {
+		return c, nil
+	}
+	value := append([]byte(nil), c.Value...)
+	err := walkOverflow(s, c.Overflow, func(id PageID, data []byte) error {
+		value = append(value, data...)
+		return nil
+	})
+	if err != nil {
+		return c, err
+	}
+	c.Value = value
+	c.Overflow = 0
+	return c, nil
+}
+
+// FreeOverflow releases the overflow pages of the cell, if any.
+func FreeOverflow(s Store, c Cell) error {
+	return walkOverflow(s, c.Overflow, func(id PageID, data []byte) error {
+		return s.Free(id)
+	})
+}
+
+func walkOverflow(s Store, id PageID, f func(id PageID, data []byte) error) error {
+	seen := make(map[PageID]bool)
+	for id != 0 {
+		if seen[id] {
+			return fmt.Errorf("overflow: cycle at page %d", id)
+		}
+		seen[id] = true
+		b, err := s.ReadPage(id)
+		if err != nil {
+			return err
+		}
+		if len(b) < overflowHeaderSize {
+			return fmt.Errorf("overflow: page %d: %w", id, ErrTruncated)
+		}
+		next := PageID(binary.BigEndian.Uint16(b[0:2]))
+		n := int(binary.BigEndian.Uint16(b[2:4]))
+		if len(b) < overflowHeaderSize+n {
+			return fmt.Errorf("overflow: page %d: %w", id, ErrTruncated)
+		}
+		if err := f(id, b[overflowHeaderSize:overflowHeaderSize+n]); err != nil {
+			return err
+		}
+		id = next
+	}
+	return nil
+}
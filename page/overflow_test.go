@@ -0,0 +1,147 @@
+package page
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+// in-memory Store; page 0 is never handed out
+type memStore struct {
+	pages map[PageID][]byte
+	next  PageID
+}
+
+func newMemStore() *memStore {
+	return &memStore{pages: make(map[PageID][]byte), next: 1}
+}
+
+func (m *memStore) Allocate() (PageID, error) {
+	id := m.next
+	m.next++
+	m.pages[id] = nil
+	return id, nil
+}
+func (m *memStore) Free(id PageID) error {
+	delete(m.pages, id)
+	return nil
+}
+func (m *memStore) ReadPage(id PageID) ([]byte, error) {
+	b, ok := m.pages[id]
+	if !ok {
+		return nil, fmt.Errorf("no page %d", id)
+	}
+	return b, nil
+}
+func (m *memStore) WritePage(id PageID, b []byte) error {
+	m.pages[id] = append([]byte(nil), b...)
+	return nil
+}
+
+// failStore is a memStore whose allocations or writes fail after a while
+type failStore struct {
+	*memStore
+	allocs, writes int // the number that succeed
+}
+
+func (f *failStore) Allocate() (PageID, error) {
+	if f.allocs == 0 {
+		return 0, fmt.Errorf("out of pages")
+	}
+	f.allocs--
+	return f.memStore.Allocate()
+}
+func (f *failStore) WritePage(id PageID, b []byte) error {
+	if f.writes == 0 {
+		return fmt.Errorf("write failed")
+	}
+	f.writes--
+	return f.memStore.WritePage(id, b)
+}
+
+func TestSpill(t *testing.T) {
+	cases := []struct {
+		desc      string
+		valueSize int
+		pages     int
+	}{
+		{desc: "fits", valueSize: 10, pages: 0},
+		{desc: "one page", valueSize: 100, pages: 1},
+		{desc: "many pages", valueSize: 5000, pages: 41},
+	}
+	const pageSize = 128
+	for _, tc := range cases {
+		t.Run(tc.desc, func(t *testing.T) {
+			s := newMemStore()
+			value := make([]byte, tc.valueSize)
+			for i := range value {
+				value[i] = byte(i)
+			}
+			orig := NewValueCell("key", value)
+
+			cell, err := Spill(s, orig, pageSize)
+			if err != nil {
+				t.Fatalf("failed to spill: %s", err)
+			}
+			if len(s.pages) != tc.pages {
+				t.Fatalf("want %d overflow pages, got %d", tc.pages, len(s.pages))
+			}
+			if cell.DiskSize() > MaxCellSize(pageSize) {
+				t.Fatalf("cell of %d bytes does not fit; max is %d", cell.DiskSize(), MaxCellSize(pageSize))
+			}
+
+			// the spilled cell goes through a page as usual
+			p, _ := NewPage(pageSize)
+			if _, err := p.Insert(cell); err != nil {
+				t.Fatalf("failed to insert: %s", err)
+			}
+			b, err := NewCodec(p).Bytes()
+			if err != nil {
+				t.Fatalf("failed to write: %s", err)
+			}
+			decoded, err := Decode(b)
+			if err != nil {
+				t.Fatalf("failed to decode: %s", err)
+			}
+
+			got, err := Assemble(s, decoded.Cells[0])
+			if err != nil {
+				t.Fatalf("failed to assemble: %s", err)
+			}
+			if !bytes.Equal(got.Value, value) || got.Overflow != 0 {
+				t.Fatalf("value mismatch after assemble")
+			}
+
+			if err := FreeOverflow(s, decoded.Cells[0]); err != nil {
+				t.Fatalf("failed to free: %s", err)
+			}
+			if len(s.pages) != 0 {
+				t.Fatalf("expected all overflow pages freed, got %d left", len(s.pages))
+			}
+		})
+	}
+}
+
+func TestSpillFails(t *testing.T) {
+	cases := []struct {
+		desc           string
+		allocs, writes int
+	}{
+		{desc: "first allocation", allocs: 0, writes: 100},
+		{desc: "later allocation", allocs: 3, writes: 100},
+		{desc: "first write", allocs: 100, writes: 0},
+		{desc: "later write", allocs: 100, writes: 3},
+	}
+	const pageSize = 128
+	for _, tc := range cases {
+		t.Run(tc.desc, func(t *testing.T) {
+			s := &failStore{memStore: newMemStore(), allocs: tc.allocs, writes: tc.writes}
+			if _, err := Spill(s, NewValueCell("key", make([]byte, 1000)), pageSize); err == nil {
+				t.Fatalf("expected spill to fail")
+			}
+			if len(s.pages) != 0 {
+				t.Fatalf("expected the partial chain freed, got %d pages left", len(s.pages))
+			}
+		})
+	}
+}
@@ -1,16 +1,31 @@
 package page
 
-import "fmt"
+import (
+	"encoding/binary"
+	"fmt"
+	"slices"
+	"strings"
+)
 
 // cell -> page -> tree
 // one tree on many pages; many cells into one page
 
+// On disk, a page looks like this:
+//
+//	| header | ncells | offsets -> | ... free ... | <- cells |
+//
+// The offsets grow forward from the header, and the cells are packed from the
+// end of the page and backwards. Offsets[i] points to Cells[i], and both are
+// sorted by key.
+
 type PageID uint16
 
 type Page struct {
 	Header  Header
 	Offsets []CellPointer
 	Cells   []Cell
+
+	free *FreeSlots // lazily built; see Page.freeSlots
 }
 
 func NewPage(size int) (*Page, error) {
@@ -24,19 +39,197 @@ func NewPage(size int) (*Page, error) {
 	}, nil
 }
 
+// number of bytes used before the offsets; header and cell count
+func (p *Page) prefixSize() int {
+	return p.Header.DiskSize() + 2
+}
+
 func (p *Page) Write(b []byte) (int, error) {
-	// b := bytes.Buffer{}
-	// io.Writer
-	// b.Write(p.Header.Bytes())
-	return 0, fmt.Errorf("not implemented")
+	size := int(p.Header.PageSize)
+	if len(b) < size {
+		return 0, fmt.Errorf("page: buffer too small; want %d bytes, got %d", size, len(b))
+	}
+	clear(b[:size])
+	n, err := p.Header.Write(b)
+	if err != nil {
+		return 0, err
+	}
+	binary.BigEndian.PutUint16(b[n:n+2], uint16(len(p.Offsets)))
+	n += 2
+	for i, ptr := range p.Offsets {
+		binary.BigEndian.PutUint16(b[n:n+2], uint16(ptr))
+		n += 2
+		c := p.Cells[i]
+		if int(ptr) < n || int(ptr)+c.DiskSize() > size {
+			return 0, fmt.Errorf("page: cell %d at %d out of bounds", i, ptr)
+		}
+		if _, err := c.Write(b[ptr:size]); err != nil {
+			return 0, err
+		}
+	}
+	return size, nil
+}
+
+// Decode reads a page previously serialized with Page.Write
+func Decode(b []byte) (*Page, error) {
+	h, n, err := decodeHeader(b)
+	if err != nil {
+		return nil, err
+	}
+	size := int(h.PageSize)
+	if len(b) < size {
+		return nil, ErrTruncated
+	}
+	b = b[:size]
+	if len(b) < n+2 {
+		return nil, ErrTruncated
+	}
+	count := int(binary.BigEndian.Uint16(b[n : n+2]))
+	n += 2
+	if len(b) < n+2*count {
+		return nil, ErrTruncated
+	}
+
+	p := &Page{Header: h}
+	for i := 0; i < count; i++ {
+		ptr := CellPointer(binary.BigEndian.Uint16(b[n : n+2]))
+		n += 2
+		if int(ptr) >= size {
+			return nil, fmt.Errorf("page: cell %d at %d out of bounds: %w", i, ptr, ErrTruncated)
+		}
+		c, _, err := DecodeCell(h.CType, b[ptr:])
+		if err != nil {
+			return nil, fmt.Errorf("page: cell %d: %w", i, err)
+		}
+		p.Offsets = append(p.Offsets, ptr)
+		p.Cells = append(p.Cells, c)
+	}
+	if err := p.buildFreeSlots(); err != nil {
+		return nil, err
+	}
+	return p, nil
 }
 
+// Insert adds the cell to the page, keeping the cells sorted by key. All
+// cells within a page must share the same type; the first cell decides.
 func (p *Page) Insert(cell Cell) (CellPointer, error) {
-	return 0, ErrNoSpace
+	if err := cell.check(); err != nil {
+		return 0, err
+	}
+	if len(p.Cells) == 0 {
+		p.Header.CType = cell.Type
+	} else if cell.Type != p.Header.CType {
+		return 0, ErrCellType
+	}
+	i, found := p.search(cell.Key)
+	if found {
+		return 0, ErrKeyExists
+	}
+	size := CellSize(cell.DiskSize())
+	if int(size)+2 > p.FreeSpace() {
+		return 0, ErrNoSpace
+	}
+
+	sl := p.reserve(size)
+	if sl == nil {
+		// there's enough space in total, but it's fragmented, or a cell is
+		// in the way of the offsets. Move everything together and try again;
+		// that leaves one slot with all free space, right after the offsets
+		p.Compact()
+		if sl = p.reserve(size); sl == nil {
+			return 0, ErrNoSpace
+		}
+	}
+
+	p.Offsets = slices.Insert(p.Offsets, i, sl.p)
+	p.Cells = slices.Insert(p.Cells, i, cell)
+	return sl.p, nil
+}
+
+// reserve reserves space for a cell of the given size, and for the offset
+// array to grow by one, which must not run into any cell. It returns nil
+// if either doesn't fit.
+func (p *Page) reserve(size CellSize) *slot {
+	free := p.freeSlots()
+	offset := free.reserveAt(p.offsetsEnd(), 2)
+	if offset == nil {
+		return nil
+	}
+	sl := free.Reserve(size)
+	if sl == nil {
+		free.Free(offset)
+	}
+	return sl
+}
+
+// Delete removes the cell with the given key, and returns its space to the
+// free list. Returns false if the key was not found.
+func (p *Page) Delete(key string) bool {
+	i, found := p.search(key)
+	if !found {
+		return false
+	}
+	free := p.freeSlots()
+	free.Free(&slot{p: p.Offsets[i], size: CellSize(p.Cells[i].DiskSize())})
+	p.Offsets = slices.Delete(p.Offsets, i, i+1)
+	p.Cells = slices.Delete(p.Cells, i, i+1)
+	free.Free(&slot{p: CellPointer(p.offsetsEnd()), size: 2})
+	return true
+}
+
+// Compact rewrites the cells contiguously at the end of the page, in key
+// order, so all free space ends up in one slot between the offsets and the
+// cells.
+func (p *Page) Compact() {
+	ptr := CellPointer(p.Header.PageSize)
+	for i := range p.Cells {
+		ptr = ptr.Sub(CellSize(p.Cells[i].DiskSize()))
+		p.Offsets[i] = ptr
+	}
+	if err := p.buildFreeSlots(); err != nil {
+		panic(err)
+	}
+}
+
+// end of the offset array, i.e. where the next offset would be written
+func (p *Page) offsetsEnd() CellPointer {
+	return CellPointer(p.prefixSize() + 2*len(p.Offsets))
+}
+
+// freeSlots returns the free list of the page. Pages that were constructed
+// by hand don't have one, so we build it from the live cells.
+func (p *Page) freeSlots() *FreeSlots {
+	if p.free == nil {
+		if err := p.buildFreeSlots(); err != nil {
+			panic(err)
+		}
+	}
+	return p.free
+}
+
+func (p *Page) buildFreeSlots() error {
+	free := NewFreeSlots(int(p.Header.PageSize))
+	if free.reserveAt(0, CellSize(p.offsetsEnd())) == nil {
+		return fmt.Errorf("page: %d offsets do not fit in page", len(p.Offsets))
+	}
+	for i, ptr := range p.Offsets {
+		if free.reserveAt(ptr, CellSize(p.Cells[i].DiskSize())) == nil {
+			return fmt.Errorf("page: cell %d at %d overlaps another cell", i, ptr)
+		}
+	}
+	p.free = free
+	return nil
+}
+
+// returns the index where key is or should be, and whether it exists
+func (p *Page) search(key string) (int, bool) {
+	return slices.BinarySearchFunc(p.Cells, key, func(c Cell, key string) int {
+		return strings.Compare(c.Key, key)
+	})
 }
 
 func (p *Page) FreeSpace() int {
-	n := int(p.Header.PageSize) - p.Header.DiskSize() - len(p.Offsets)*2
+	n := int(p.Header.PageSize) - p.prefixSize() - len(p.Offsets)*2
 	for _, c := range p.Cells {
 		n -= c.DiskSize()
 	}
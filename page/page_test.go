@@ -1,11 +1,17 @@
 package page
 
-import "testing"
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"slices"
+	"testing"
+)
 
 func TestInsert(t *testing.T) {
-	p, _ := NewPage(30)
+	p, _ := NewPage(38)
 
-	if _, err := p.Insert(NewKeyCell("foo", 10)); err != nil {
+	if _, err := p.Insert(NewValueCell("foo", []byte("zz"))); err != nil {
 		t.Fatalf("failed to insert: %s", err)
 	}
 
@@ -19,15 +25,164 @@ func TestInsert(t *testing.T) {
 	}
 
 	want := []byte{
-		30, 0x01, // header
-		0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
-		0, 30, // pointer to first cell
-		0, 10, // pointer to 2nd cell
-		3, 10, 'f', 'o', 'o', // first cell
-		3, 2, 'b', 'a', 'r', 'x', 'x', // 2nd cell
+		0, 38, 0x01, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, // header
+		0, 2, // number of cells
+		0, 24, // pointer to first cell (bar)
+		0, 31, // pointer to 2nd cell (foo)
+		0, 0, 0, 0, 0,
+		3, 2 << 1, 'b', 'a', 'r', 'x', 'x', // 2nd cell inserted
+		3, 2 << 1, 'f', 'o', 'o', 'z', 'z', // first cell inserted
 	}
-	if len(want) != 30 {
-		t.Fatalf("expected 30, got %d", len(want)) // sanity check
+	if len(want) != 38 {
+		t.Fatalf("expected 38, got %d", len(want)) // sanity check
 	}
 	expectBytesEq(t, want, got)
 }
+
+func TestInsertErrors(t *testing.T) {
+	p, _ := NewPage(28)
+	if _, err := p.Insert(NewKeyCell("foo", 10)); err != nil {
+		t.Fatalf("failed to insert: %s", err)
+	}
+	if _, err := p.Insert(NewValueCell("bar", nil)); !errors.Is(err, ErrCellType) {
+		t.Fatalf("want ErrCellType, got %v", err)
+	}
+	if _, err := p.Insert(NewKeyCell("foo", 11)); !errors.Is(err, ErrKeyExists) {
+		t.Fatalf("want ErrKeyExists, got %v", err)
+	}
+	if _, err := p.Insert(NewKeyCell("bazbaz", 11)); !errors.Is(err, ErrNoSpace) {
+		t.Fatalf("want ErrNoSpace, got %v", err)
+	}
+}
+
+func TestDecode(t *testing.T) {
+	p, _ := NewPage(64)
+	for _, k := range []string{"m", "c", "x", "a"} {
+		if _, err := p.Insert(NewKeyCell(k, PageID(k[0]))); err != nil {
+			t.Fatalf("failed to insert: %s", err)
+		}
+	}
+	b := make([]byte, 64)
+	if _, err := p.Write(b); err != nil {
+		t.Fatalf("failed to write: %s", err)
+	}
+	got, err := Decode(b)
+	if err != nil {
+		t.Fatalf("failed to decode: %s", err)
+	}
+	expectPageEq(t, p, got)
+
+	if _, err := Decode(b[:40]); !errors.Is(err, ErrTruncated) {
+		t.Fatalf("want ErrTruncated, got %v", err)
+	}
+}
+
+func TestDelete(t *testing.T) {
+	p, _ := NewPage(42)
+	for _, k := range []string{"foo", "bar", "baz"} {
+		if _, err := p.Insert(NewValueCell(k, []byte("xx"))); err != nil {
+			t.Fatalf("failed to insert %q: %s", k, err)
+		}
+	}
+	if _, err := p.Insert(NewValueCell("qux", []byte("xx"))); !errors.Is(err, ErrNoSpace) {
+		t.Fatalf("want ErrNoSpace, got %v", err)
+	}
+	if p.Delete("nope") {
+		t.Fatalf("deleted a key that does not exist")
+	}
+	if !p.Delete("bar") {
+		t.Fatalf("failed to delete bar")
+	}
+	ptr, err := p.Insert(NewValueCell("qux", []byte("yy")))
+	if err != nil {
+		t.Fatalf("failed to insert after delete: %s", err)
+	}
+	if ptr != 28 {
+		t.Fatalf("expected qux to reuse the slot of bar at 28, got %d", ptr)
+	}
+
+	b := make([]byte, 42)
+	if _, err := p.Write(b); err != nil {
+		t.Fatalf("failed to write: %s", err)
+	}
+	got, err := Decode(b)
+	if err != nil {
+		t.Fatalf("failed to decode: %s", err)
+	}
+	expectPageEq(t, p, got)
+	if got.FreeSpace() != p.FreeSpace() {
+		t.Fatalf("free space mismatch; want=%d, got=%d", p.FreeSpace(), got.FreeSpace())
+	}
+}
+
+func TestCompact(t *testing.T) {
+	p, _ := NewPage(48)
+	for _, k := range []string{"a", "b", "c", "d"} {
+		if _, err := p.Insert(NewValueCell(k, []byte("xx"))); err != nil {
+			t.Fatalf("failed to insert %q: %s", k, err)
+		}
+	}
+	p.Delete("a")
+	p.Delete("c")
+
+	// 21 bytes are free, but split over three slots of which none fits the cell
+	cell := NewValueCell("e", []byte("123456789"))
+	if p.FreeSpace() < cell.DiskSize()+2 {
+		t.Fatalf("expected enough free space, got %d", p.FreeSpace())
+	}
+	if _, err := p.Insert(cell); err != nil {
+		t.Fatalf("failed to insert after compaction: %s", err)
+	}
+	if want := []CellPointer{43, 38, 26}; !slices.Equal(p.Offsets, want) {
+		t.Fatalf("offsets mismatch; want=%v, got=%v", want, p.Offsets)
+	}
+	if n := len(p.freeSlots().slots); n != 1 {
+		t.Fatalf("expected a single free slot, got %d: %v", n, p.freeSlots().slots)
+	}
+}
+
+// A cell right after the offsets leaves no room for the offset array to grow
+// until the page is compacted
+func TestInsertCellAfterOffsets(t *testing.T) {
+	p, _ := NewPage(64)
+	cell := NewValueCell("a", []byte("xx"))
+	p.Header.CType = cell.Type
+	p.Offsets = []CellPointer{p.offsetsEnd() + 2}
+	p.Cells = []Cell{cell}
+	if err := p.buildFreeSlots(); err != nil {
+		t.Fatal(err)
+	}
+
+	big := NewValueCell("b", []byte("123456789"))
+	if p.FreeSpace() < big.DiskSize()+2 {
+		t.Fatalf("expected enough free space, got %d", p.FreeSpace())
+	}
+	if _, err := p.Insert(big); err != nil {
+		t.Fatalf("failed to insert next to the offsets: %s", err)
+	}
+	if want := []CellPointer{59, 47}; !slices.Equal(p.Offsets, want) {
+		t.Fatalf("offsets mismatch; want=%v, got=%v", want, p.Offsets)
+	}
+}
+
+// Insert only gives up when the page is really full
+func TestInsertStress(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	p, _ := NewPage(128)
+	for i := range 20000 {
+		key := fmt.Sprintf("k%02d", rng.Intn(40))
+		if rng.Intn(2) == 0 {
+			p.Delete(key)
+			continue
+		}
+		cell := NewValueCell(key, make([]byte, rng.Intn(12)))
+		free := p.FreeSpace()
+		_, err := p.Insert(cell)
+		if errors.Is(err, ErrNoSpace) && cell.DiskSize()+2 <= free {
+			t.Fatalf("op %d: %d byte cell rejected with %d bytes free", i, cell.DiskSize(), free)
+		}
+		if err != nil && !errors.Is(err, ErrNoSpace) && !errors.Is(err, ErrKeyExists) {
+			t.Fatal(err)
+		}
+	}
+}
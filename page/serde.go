@@ -1,9 +1,116 @@
 package page
 
-import "io"
+import (
+	"fmt"
+	"io"
+)
 
 type Serde interface {
 	io.Writer
-	// Bytes(h Header) []byte
 	FromBytes(any, []byte) error
 }
+
+// Codec implements Serde for Header, Cell and Page. The value given to
+// NewCodec is serialized by Write, and FromBytes decodes into a *Header,
+// *Cell or *Page.
+//
+// A Cell on its own is prefixed with its type; within a page, the type is
+// given by the page header instead.
+type Codec struct {
+	v any
+}
+
+var _ Serde = (*Codec)(nil)
+
+func NewCodec(v any) *Codec {
+	return &Codec{v: v}
+}
+
+// DiskSize is the number of bytes Write needs
+func (c *Codec) DiskSize() (int, error) {
+	switch v := c.v.(type) {
+	case Header:
+		return v.DiskSize(), nil
+	case *Header:
+		return v.DiskSize(), nil
+	case Cell:
+		return 1 + v.DiskSize(), nil
+	case *Cell:
+		return 1 + v.DiskSize(), nil
+	case Page:
+		return int(v.Header.PageSize), nil
+	case *Page:
+		return int(v.Header.PageSize), nil
+	}
+	return 0, fmt.Errorf("codec: unsupported type %T", c.v)
+}
+
+func (c *Codec) Write(b []byte) (int, error) {
+	switch v := c.v.(type) {
+	case Header:
+		return v.Write(b)
+	case *Header:
+		return v.Write(b)
+	case Cell:
+		return writeTaggedCell(&v, b)
+	case *Cell:
+		return writeTaggedCell(v, b)
+	case Page:
+		return v.Write(b)
+	case *Page:
+		return v.Write(b)
+	}
+	return 0, fmt.Errorf("codec: unsupported type %T", c.v)
+}
+
+// Bytes returns the serialized value
+func (c *Codec) Bytes() ([]byte, error) {
+	size, err := c.DiskSize()
+	if err != nil {
+		return nil, err
+	}
+	b := make([]byte, size)
+	n, err := c.Write(b)
+	if err != nil {
+		return nil, err
+	}
+	return b[:n], nil
+}
+
+func (c *Codec) FromBytes(dst any, b []byte) error {
+	switch dst := dst.(type) {
+	case *Header:
+		h, _, err := decodeHeader(b)
+		if err != nil {
+			return err
+		}
+		*dst = h
+	case *Cell:
+		if len(b) < 1 {
+			return ErrTruncated
+		}
+		cell, _, err := DecodeCell(CellType(b[0]), b[1:])
+		if err != nil {
+			return err
+		}
+		*dst = cell
+	case *Page:
+		p, err := Decode(b)
+		if err != nil {
+			return err
+		}
+		*dst = *p
+	default:
+		return fmt.Errorf("codec: unsupported type %T", dst)
+	}
+	return nil
+}
+
+func writeTaggedCell(c *Cell, b []byte) (int, error) {
+	if len(b) < 1+c.DiskSize() {
+		return 0, ErrTruncated
+	}
+	b[0] = uint8(c.Type)
+	n, err := c.Write(b[1:])
+	return n + 1, err
+}
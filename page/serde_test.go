@@ -0,0 +1,168 @@
+package page
+
+import (
+	"errors"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestCodecErrors(t *testing.T) {
+	cases := []struct {
+		desc string
+		dst  any
+		b    []byte
+		want error
+	}{
+		{desc: "empty cell", dst: &Cell{}, b: nil, want: ErrTruncated},
+		{desc: "short cell", dst: &Cell{}, b: []byte{1, 3, 2, 'a'}, want: ErrTruncated},
+		{desc: "unknown cell type", dst: &Cell{}, b: []byte{7, 0, 0}, want: ErrUnknownCellType},
+		{desc: "short header", dst: &Header{}, b: []byte{0, 30}, want: ErrTruncated},
+		{desc: "unknown page type", dst: &Page{}, b: []byte{0, 15, 9, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}, want: ErrUnknownCellType},
+		{desc: "short page", dst: &Page{}, b: []byte{0, 30, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}, want: ErrTruncated},
+	}
+	for _, tc := range cases {
+		t.Run(tc.desc, func(t *testing.T) {
+			var c Codec
+			if err := c.FromBytes(tc.dst, tc.b); !errors.Is(err, tc.want) {
+				t.Fatalf("want %v, got %v", tc.want, err)
+			}
+		})
+	}
+
+	long := NewValueCell("k", make([]byte, 1<<16))
+	if _, err := NewCodec(long).Bytes(); !errors.Is(err, ErrOverflow) {
+		t.Fatalf("want ErrOverflow, got %v", err)
+	}
+	p, _ := NewPage(math.MaxUint16)
+	if _, err := p.Insert(long); !errors.Is(err, ErrOverflow) {
+		t.Fatalf("want ErrOverflow, got %v", err)
+	}
+}
+
+func FuzzHeader(f *testing.F) {
+	f.Add(uint16(30), uint8(0), uint16(0), uint64(0))
+	f.Add(uint16(4096), uint8(1), uint16(12), uint64(1234))
+	f.Fuzz(func(t *testing.T, size uint16, ctype uint8, right uint16, lsn uint64) {
+		h := Header{PageSize: size, CType: CellType(ctype % 2), Right: PageID(right), LSN: lsn}
+		b, err := NewCodec(h).Bytes()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got Header
+		if err := NewCodec(nil).FromBytes(&got, b); err != nil {
+			t.Fatal(err)
+		}
+		if got != h {
+			t.Fatalf("want %+v, got %+v", h, got)
+		}
+	})
+}
+
+func TestHeaderLink(t *testing.T) {
+	cases := []Header{
+		{PageSize: 128, CType: CellTypeKey, Right: 3, Link: 7, HighKey: "m"},
+		{PageSize: 128, CType: CellTypeValue, Right: 7, LSN: 9, Link: 7},
+		{PageSize: 4096, CType: CellTypeValue, Link: 1, HighKey: strings.Repeat("k", 300)},
+	}
+	for _, h := range cases {
+		b, err := NewCodec(h).Bytes()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got Header
+		if err := NewCodec(nil).FromBytes(&got, b); err != nil {
+			t.Fatal(err)
+		}
+		if got != h {
+			t.Fatalf("want %+v, got %+v", h, got)
+		}
+		if err := NewCodec(nil).FromBytes(&got, b[:len(b)-1]); !errors.Is(err, ErrTruncated) {
+			t.Fatalf("short header with link: want ErrTruncated, got %v", err)
+		}
+	}
+
+	// cells go after the high key
+	p, _ := NewPage(128)
+	p.Header.Link, p.Header.HighKey = 4, "zz"
+	for _, k := range []string{"a", "b", "c"} {
+		if _, err := p.Insert(NewKeyCell(k, 2)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	b, err := NewCodec(p).Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got Page
+	if err := NewCodec(nil).FromBytes(&got, b); err != nil {
+		t.Fatal(err)
+	}
+	expectPageEq(t, p, &got)
+}
+
+func FuzzCell(f *testing.F) {
+	f.Add(uint8(0), "foo", []byte(nil), uint16(10))
+	f.Add(uint8(1), "bar", []byte("xx"), uint16(0))
+	f.Add(uint8(1), "blå", []byte("xx"), uint16(7))
+	f.Fuzz(func(t *testing.T, ctype uint8, key string, value []byte, id uint16) {
+		c := Cell{Type: CellType(ctype % 2), Key: key, PageID: PageID(id)}
+		if c.Type == CellTypeValue {
+			c.Value = value
+			c.Overflow = PageID(id)
+		} else {
+			c.Value = nil
+		}
+		b, err := NewCodec(c).Bytes()
+		if errors.Is(err, ErrOverflow) {
+			return
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got Cell
+		if err := NewCodec(nil).FromBytes(&got, b); err != nil {
+			t.Fatal(err)
+		}
+		if c.Type == CellTypeValue {
+			c.PageID = 0
+		}
+		expectCellEq(t, c, got)
+	})
+}
+
+func FuzzPage(f *testing.F) {
+	f.Add(uint16(64), uint8(0), "a,b,c")
+	f.Add(uint16(128), uint8(1), "foo,bar,baz,qux")
+	f.Fuzz(func(t *testing.T, size uint16, ctype uint8, keys string) {
+		p, err := NewPage(int(size))
+		if err != nil || int(size) < p.prefixSize() {
+			return
+		}
+		for i, k := range splitKeys(keys) {
+			c := Cell{Type: CellType(ctype % 2), Key: k, PageID: PageID(i)}
+			if c.Type == CellTypeValue {
+				c.PageID, c.Value = 0, []byte(k)
+			}
+			p.Insert(c) // errors are fine; we just want some cells
+		}
+		b, err := NewCodec(p).Bytes()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got Page
+		if err := NewCodec(nil).FromBytes(&got, b); err != nil {
+			t.Fatal(err)
+		}
+		expectPageEq(t, p, &got)
+	})
+}
+
+func FuzzDecode(f *testing.F) {
+	f.Add([]byte{0, 30, 1, 0, 1, 0, 20})
+	f.Fuzz(func(t *testing.T, b []byte) {
+		// must not panic; errors are expected
+		var p Page
+		NewCodec(nil).FromBytes(&p, b)
+	})
+}
@@ -24,10 +24,8 @@ func Graphviz(t Tree, fname string) {
 			}
 			fmt.Fprintf(s, "%d [color=%q]\n", n.Key, color)
 		}
-		fmt.Printf("node %s", n.String())
 	})
 	s.WriteString("}\n")
-	fmt.Printf("got %s\n", s.String())
 
 	dotFile := fmt.Sprintf("%s.dot", fname)
 	f, err := os.OpenFile(dotFile, os.O_RDWR|os.O_CREATE, 0644)
@@ -0,0 +1,63 @@
+package rb
+
+import "iter"
+
+// The iterators below yield every key along with its node. Ranges are
+// half-open, like [lo, hi).
+
+// All yields every key in ascending order
+func (t *TreeOf[K, V]) All() iter.Seq2[K, *NodeOf[K, V]] {
+	return func(yield func(K, *NodeOf[K, V]) bool) {
+		t.ascend(t.Root, nil, yield)
+	}
+}
+
+// Ascend yields the keys >= from in ascending order
+func (t *TreeOf[K, V]) Ascend(from K) iter.Seq2[K, *NodeOf[K, V]] {
+	return func(yield func(K, *NodeOf[K, V]) bool) {
+		t.ascend(t.Root, &from, yield)
+	}
+}
+
+// Descend yields the keys <= from in descending order
+func (t *TreeOf[K, V]) Descend(from K) iter.Seq2[K, *NodeOf[K, V]] {
+	return func(yield func(K, *NodeOf[K, V]) bool) {
+		t.descend(t.Root, from, yield)
+	}
+}
+
+// Between yields the keys in [lo, hi) in ascending order
+func (t *TreeOf[K, V]) Between(lo, hi K) iter.Seq2[K, *NodeOf[K, V]] {
+	return func(yield func(K, *NodeOf[K, V]) bool) {
+		t.ascend(t.Root, &lo, func(k K, n *NodeOf[K, V]) bool {
+			return k < hi && yield(k, n)
+		})
+	}
+}
+
+// ascend visits the keys >= lo below n, or all of them if lo is nil, and
+// returns false once yield does
+func (t *TreeOf[K, V]) ascend(n *NodeOf[K, V], lo *K, yield func(K, *NodeOf[K, V]) bool) bool {
+	if t.leaf(n) {
+		return true
+	}
+	if lo == nil || n.Key >= *lo {
+		if !t.ascend(n.Left, lo, yield) || !yield(n.Key, n) {
+			return false
+		}
+	}
+	return t.ascend(n.Right, lo, yield)
+}
+
+// descend visits the keys <= hi below n, from the largest
+func (t *TreeOf[K, V]) descend(n *NodeOf[K, V], hi K, yield func(K, *NodeOf[K, V]) bool) bool {
+	if t.leaf(n) {
+		return true
+	}
+	if n.Key <= hi {
+		if !t.descend(n.Right, hi, yield) || !yield(n.Key, n) {
+			return false
+		}
+	}
+	return t.descend(n.Left, hi, yield)
+}
@@ -0,0 +1,77 @@
+package rb
+
+import (
+	"iter"
+	"slices"
+	"testing"
+)
+
+func keysOf(seq iter.Seq2[int, *Node]) []int {
+	var res []int
+	for k, n := range seq {
+		if n.Key != k {
+			panic("key does not match its node")
+		}
+		res = append(res, k)
+	}
+	return res
+}
+
+// Insert keeps duplicate keys, and the iterators yield each of them
+func TestIterators(t *testing.T) {
+	var tree Tree
+	tree.Insert(5, 3, 8, 3, 1, 8, 8, 6)
+	tree.Put(6, struct{}{}) // already there, so not another 6
+
+	cases := []struct {
+		desc string
+		seq  iter.Seq2[int, *Node]
+		want []int
+	}{
+		{"all", tree.All(), []int{1, 3, 3, 5, 6, 8, 8, 8}},
+		{"ascend", tree.Ascend(4), []int{5, 6, 8, 8, 8}},
+		{"ascend/duplicate", tree.Ascend(3), []int{3, 3, 5, 6, 8, 8, 8}},
+		{"descend", tree.Descend(7), []int{6, 5, 3, 3, 1}},
+		{"descend/duplicate", tree.Descend(8), []int{8, 8, 8, 6, 5, 3, 3, 1}},
+		{"between", tree.Between(3, 8), []int{3, 3, 5, 6}},
+		{"between/empty", tree.Between(6, 6), nil},
+		{"empty", (&Tree{}).All(), nil},
+	}
+	for _, tc := range cases {
+		t.Run(tc.desc, func(t *testing.T) {
+			if got := keysOf(tc.seq); !slices.Equal(got, tc.want) {
+				t.Fatalf("got %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+// Stopping a loop early stops the iterator, even among duplicates
+func TestIteratorsBreak(t *testing.T) {
+	var tree Tree
+	tree.Insert(1, 2, 2, 2, 3, 4, 4, 5)
+	cases := []struct {
+		desc string
+		seq  iter.Seq2[int, *Node]
+		want []int
+	}{
+		{"all", tree.All(), []int{1, 2, 2}},
+		{"ascend", tree.Ascend(2), []int{2, 2, 2}},
+		{"descend", tree.Descend(4), []int{4, 4, 3}},
+		{"between", tree.Between(2, 5), []int{2, 2, 2}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.desc, func(t *testing.T) {
+			var got []int
+			for k := range tc.seq {
+				got = append(got, k)
+				if len(got) == 3 {
+					break
+				}
+			}
+			if !slices.Equal(got, tc.want) {
+				t.Fatalf("got %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
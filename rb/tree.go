@@ -1,6 +1,9 @@
 package rb
 
-import "fmt"
+import (
+	"cmp"
+	"fmt"
+)
 
 /*
 1. every node marked red or black
@@ -17,29 +20,50 @@ Allows efficient traversal,
 // root is black; NIL's black
 // all paths from node to a leaf contain same number of black nodes
 
-type Node struct {
-	Key                 int
-	Left, Right, Parent *Node
+// NodeOf is a node of a tree with keys of type K, and values of type V
+type NodeOf[K cmp.Ordered, V any] struct {
+	Key                 K
+	Value               V
+	Left, Right, Parent *NodeOf[K, V]
 	Color
 }
 type Color int
 
-func (n *Node) String() string { return fmt.Sprintf("%d", n.Key) }
+// Node is a node of a Tree
+type Node = NodeOf[int, struct{}]
+
+func (n *NodeOf[K, V]) String() string { return fmt.Sprintf("%v", n.Key) }
 
-type Tree struct {
-	Root *Node
+// TreeOf is a red-black tree with keys of type K, and values of type V. The
+// zero value is an empty tree.
+type TreeOf[K cmp.Ordered, V any] struct {
+	Root *NodeOf[K, V]
+	nil  *NodeOf[K, V] // the sentinel; see sentinel
 }
 
+// Tree is a red-black tree of ints
+type Tree = TreeOf[int, struct{}]
+
 const (
 	RED Color = iota
 	BLACK
 )
 
-var (
-	SENTINEL = &Node{Color: BLACK}
-)
+// sentinel returns the black node that stands in for the leaves, and the
+// parent of the root. Every tree has its own, since it's written to.
+func (t *TreeOf[K, V]) sentinel() *NodeOf[K, V] {
+	if t.nil == nil {
+		t.nil = &NodeOf[K, V]{Color: BLACK}
+	}
+	return t.nil
+}
+
+// leaf reports whether n is the sentinel or nil
+func (t *TreeOf[K, V]) leaf(n *NodeOf[K, V]) bool {
+	return n == nil || n == t.nil
+}
 
-func (t *Tree) LeftRotate(x *Node) {
+func (t *TreeOf[K, V]) LeftRotate(x *NodeOf[K, V]) {
 	y := x.Right
 
 	x.Right = y.Left
@@ -60,7 +84,7 @@ func (t *Tree) LeftRotate(x *Node) {
 	x.Parent = y
 }
 
-func (t *Tree) RightRotate(x *Node) {
+func (t *TreeOf[K, V]) RightRotate(x *NodeOf[K, V]) {
 	y := x.Left
 
 	x.Left = y.Right
@@ -81,44 +105,58 @@ func (t *Tree) RightRotate(x *Node) {
 	x.Parent = y
 }
 
-func (t *Tree) Insert(key ...int) *Tree {
+func (t *TreeOf[K, V]) Insert(key ...K) *TreeOf[K, V] {
 	for _, k := range key {
 		t.insert(k)
 	}
 	return t
 }
-func (t *Tree) Find(key int) *Node {
+
+// Put sets the value of key, which is inserted if it's not in the tree
+func (t *TreeOf[K, V]) Put(key K, value V) {
+	if n := t.Find(key); n != nil {
+		n.Value = value
+		return
+	}
+	t.insert(key).Value = value
+}
+
+func (t *TreeOf[K, V]) Find(key K) *NodeOf[K, V] {
 	n := t.Root
-	for n != nil && n.Key != key {
+	for !t.leaf(n) && n.Key != key {
 		if n.Key > key {
 			n = n.Left
 		} else {
 			n = n.Right
 		}
 	}
+	if t.leaf(n) {
+		return nil
+	}
 	return n
 }
 
-func (t *Tree) Walk(f func(n *Node)) {
-	t.Root.walk(f)
+func (t *TreeOf[K, V]) Walk(f func(n *NodeOf[K, V])) {
+	t.walk(t.Root, f)
 }
-func (n *Node) walk(f func(n *Node)) {
-	if n == nil || n == SENTINEL {
+func (t *TreeOf[K, V]) walk(n *NodeOf[K, V], f func(n *NodeOf[K, V])) {
+	if t.leaf(n) {
 		return
 	}
-	fmt.Printf("walk: %d\n", n.Key)
-	n.Left.walk(f)
+	t.walk(n.Left, f)
 	f(n)
-	n.Right.walk(f)
+	t.walk(n.Right, f)
 }
 
-func (t *Tree) insert(key int) {
+// insert returns the new node
+func (t *TreeOf[K, V]) insert(key K) *NodeOf[K, V] {
 	// var par *Node
-	par := SENTINEL
+	sentinel := t.sentinel()
+	par := sentinel
 	x := t.Root
-	z := &Node{Key: key, Color: RED, Left: SENTINEL, Right: SENTINEL, Parent: SENTINEL}
+	z := &NodeOf[K, V]{Key: key, Color: RED, Left: sentinel, Right: sentinel, Parent: sentinel}
 
-	for x != nil && x != SENTINEL {
+	for !t.leaf(x) {
 		par = x
 		if z.Key < x.Key {
 			x = x.Left
@@ -127,7 +165,7 @@ func (t *Tree) insert(key int) {
 		}
 	}
 	z.Parent = par
-	if par == SENTINEL {
+	if par == sentinel {
 		t.Root = z
 	} else if par.Key > z.Key {
 		par.Left = z
@@ -137,9 +175,10 @@ func (t *Tree) insert(key int) {
 	// ^ ... so just regular BST insert, but with a correction step at the end.
 	// no sentinel T.nil is used, but maybe we need to.
 	t.InsertFixup(z)
+	return z
 }
 
-func (t *Tree) InsertFixup(z *Node) {
+func (t *TreeOf[K, V]) InsertFixup(z *NodeOf[K, V]) {
 	for z.Parent.Color == RED {
 		if z.Parent == z.Parent.Parent.Left {
 			y := z.Parent.Parent.Right // uncle
@@ -179,8 +218,8 @@ func (t *Tree) InsertFixup(z *Node) {
 	t.Root.Color = BLACK
 }
 
-func (t *Tree) Transplant(u, v *Node) {
-	if u.Parent == SENTINEL {
+func (t *TreeOf[K, V]) Transplant(u, v *NodeOf[K, V]) {
+	if u.Parent == t.sentinel() {
 		t.Root = v
 	} else if u.Parent.Left == u {
 		u.Parent.Left = v
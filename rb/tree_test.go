@@ -1,6 +1,8 @@
 package rb
 
 import (
+	"fmt"
+	"slices"
 	"testing"
 )
 
@@ -51,3 +53,20 @@ func expectOrder(t *testing.T, tree *Tree, want []int) {
 	}
 
 }
+
+func TestPut(t *testing.T) {
+	var tree TreeOf[string, int]
+	for i, k := range []string{"m", "c", "x", "a", "c", "m"} {
+		tree.Put(k, i)
+	}
+	var got []string
+	for k, n := range tree.All() {
+		got = append(got, fmt.Sprintf("%s=%d", k, n.Value))
+	}
+	if want := []string{"a=3", "c=4", "m=5", "x=2"}; !slices.Equal(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	if n := tree.Find("b"); n != nil {
+		t.Fatalf("Find of a missing key = %v", n)
+	}
+}
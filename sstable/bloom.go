@@ -0,0 +1,71 @@
+package sstable
+
+import "math"
+
+// Bloom filters
+//
+// A segment has a Bloom filter of its keys, so Get can skip a segment without
+// reading a block when the key isn't there. With b bits per key, each key sets
+// k = b ln 2 bits, which gives false positives at a rate of about 0.6185^b: 1%
+// for 10 bits per key. There are no false negatives.
+//
+// The k bits of a key are h1 + i*h2, for i < k, where h1 and h2 are the halves
+// of a 64-bit hash of the key. The filter block is the bits, and then a byte
+// holding k.
+
+const DefaultBloomBits = 10
+
+// bloom is a filter block
+type bloom []byte
+
+// newBloom returns a filter of the keys with the hashes, at bits per key
+func newBloom(hashes []uint64, bits int) bloom {
+	k := min(max(int(math.Round(float64(bits)*math.Ln2)), 1), 30)
+	n := max(len(hashes)*bits, 64)
+	f := make(bloom, (n+7)/8+1)
+	n = (len(f) - 1) * 8
+	for _, h := range hashes {
+		h1, h2 := uint32(h), uint32(h>>32)
+		for i := range k {
+			bit := (h1 + uint32(i)*h2) % uint32(n)
+			f[bit/8] |= 1 << (bit % 8)
+		}
+	}
+	f[len(f)-1] = byte(k)
+	return f
+}
+
+// mayContain reports whether the key with hash h may have been added. An
+// empty or malformed filter may contain anything.
+func (f bloom) mayContain(h uint64) bool {
+	if len(f) < 2 {
+		return true
+	}
+	k, n := int(f[len(f)-1]), uint32(len(f)-1)*8
+	if k > 30 {
+		return true
+	}
+	h1, h2 := uint32(h), uint32(h>>32)
+	for i := range k {
+		bit := (h1 + uint32(i)*h2) % n
+		if f[bit/8]&(1<<(bit%8)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// hash is 64-bit FNV-1a, with the bits mixed like the end of MurmurHash3.
+// Without that, keys that differ only at the end, like key001 and key002, have
+// similar h2s, and small filters get twice the false positives.
+func hash(key string) uint64 {
+	h := uint64(14695981039346656037)
+	for i := 0; i < len(key); i++ {
+		h ^= uint64(key[i])
+		h *= 1099511628211
+	}
+	h ^= h >> 33
+	h *= 0xff51afd7ed558ccd
+	h ^= h >> 33
+	return h
+}
@@ -0,0 +1,77 @@
+package sstable
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"testing"
+)
+
+func TestBloom(t *testing.T) {
+	const n = 10000
+	var hashes []uint64
+	for i := range n {
+		hashes = append(hashes, hash(fmt.Sprintf("key%06d", 2*i)))
+	}
+	for _, bits := range []int{2, 5, 10, 20} {
+		f := newBloom(hashes, bits)
+		for i, h := range hashes {
+			if !f.mayContain(h) {
+				t.Fatalf("%d bits: key%06d is missing", bits, 2*i)
+			}
+		}
+		positives := 0
+		for i := range n {
+			if f.mayContain(hash(fmt.Sprintf("key%06d", 2*i+1))) {
+				positives++
+			}
+		}
+		k := float64(f[len(f)-1])
+		want := math.Pow(1-math.Exp(-k/float64(bits)), k)
+		got := float64(positives) / n
+		t.Logf("%d bits per key: %d bytes, false positive rate %.4f, want %.4f", bits, len(f), got, want)
+		if got > 1.5*want+0.001 {
+			t.Errorf("%d bits per key: false positive rate is %.4f, want %.4f", bits, got, want)
+		}
+	}
+
+	if !bloom(nil).mayContain(hash("a")) {
+		t.Errorf("an empty filter rules out keys")
+	}
+}
+
+func TestBloomSegment(t *testing.T) {
+	var input []Record
+	for i := range 1000 {
+		input = append(input, rec(fmt.Sprintf("key%05d", 2*i), "value"))
+	}
+	for _, tc := range []struct {
+		bits     int
+		maxReads int
+	}{
+		{0, 30}, // about 1%
+		{20, 2},
+		{-1, 1000},
+	} {
+		b := write(t, Options{BlockSize: 256, BloomBits: tc.bits}, input...)
+		f := &countingReader{r: bytes.NewReader(b)}
+		s, err := Open(f, int64(len(b)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tc.bits < 0 && len(s.filter) != 0 {
+			t.Errorf("segment has a filter without bits")
+		}
+		f.reads = 0
+		for i := range 1000 {
+			key := fmt.Sprintf("key%05d", 2*i+1)
+			if _, ok, err := s.Get(key); ok || err != nil {
+				t.Fatalf("Get(%q) = %t, %v; want nothing", key, ok, err)
+			}
+		}
+		t.Logf("%d bits per key: %d reads for 1000 missing keys", tc.bits, f.reads)
+		if f.reads > tc.maxReads {
+			t.Errorf("%d bits per key: %d reads for 1000 missing keys, want at most %d", tc.bits, f.reads, tc.maxReads)
+		}
+	}
+}
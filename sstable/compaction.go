@@ -0,0 +1,434 @@
+package sstable
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// Compaction
+//
+// Segments pile up as memtables are flushed, which makes reads slower, and
+// overwritten records take up space. Compaction merges segments into new
+// ones, with the newest record of each key; see Merge. A CompactionStrategy
+// picks the segments to merge.
+//
+// Each segment has a level, and flushed segments go to level 0. Leveled
+// compaction keeps the segments of each level above 0 from overlapping, and
+// each level Ratio times bigger than the one before it. A read checks at most
+// one segment per level, but a record is written again each time it moves a
+// level down. Size-tiered compaction keeps segments at level 0, and merges
+// runs of segments of about the same size. A record is written fewer times,
+// but a key may be in many segments, and overwritten records linger.
+//
+// Tombstones are dropped once there are no older segments that overlap the
+// merged ones.
+
+var ErrBadCompaction = errors.New("sstable: compaction would reorder segments")
+
+// CompactionStrategy picks the segments of a DB to merge
+type CompactionStrategy interface {
+	// Pick returns the next compaction to run on the tables, which are given
+	// in the order they're read, and false if none is needed
+	Pick(tables []TableInfo) (Compaction, bool)
+}
+
+// TableInfo describes a segment of a DB
+type TableInfo struct {
+	Num         int // number of the segment file
+	Level       int
+	Size        int64
+	First, Last string // keys of the first and last record
+}
+
+func (t TableInfo) overlaps(first, last string) bool {
+	return t.First <= last && first <= t.Last
+}
+
+// Compaction merges segments. The inputs must be such that no other segment
+// with keys in their range is read between them, or Compact fails with
+// ErrBadCompaction.
+type Compaction struct {
+	Inputs []int // numbers of the segment files
+	Level  int   // of the new segments
+
+	// TableSize splits the merged records into segments of about this many
+	// bytes; 0 means one segment
+	TableSize int64
+}
+
+// CompactionStats describes a compaction run
+type CompactionStats struct {
+	Level           int   // of the new segments
+	Inputs, Outputs int   // number of segments
+	BytesRead       int64 // size of the inputs
+	BytesWritten    int64 // size of the new segments
+
+	// WriteAmp is the bytes written to segments since the DB was opened, by
+	// flushes and compactions, over the bytes written by flushes; 0 if
+	// nothing has been flushed
+	WriteAmp float64
+
+	// SpaceAmp estimates the space amplification from the segment sizes,
+	// as the size of all segments over that of the largest level, which
+	// is about the size of the live records. Level 0 segments overlap, so
+	// level 0 counts by its largest segment. 0 if there are no segments;
+	// see DB.SpaceAmp for the exact figure.
+	SpaceAmp float64
+}
+
+// Leveled is a CompactionStrategy that merges level 0 into level 1 once it
+// has L0Tables segments, and a segment of a larger level into the next one
+// once the level is over its size
+type Leveled struct {
+	L0Tables  int   // defaults to 4
+	L1Size    int64 // defaults to 10 MB
+	Ratio     int   // size of a level over that of the one before; defaults to 10
+	TableSize int64 // size of the new segments; defaults to 2 MB
+}
+
+func (l Leveled) Pick(tables []TableInfo) (Compaction, bool) {
+	if l.L0Tables == 0 {
+		l.L0Tables = 4
+	}
+	if l.L1Size == 0 {
+		l.L1Size = 10 << 20
+	}
+	if l.Ratio == 0 {
+		l.Ratio = 10
+	}
+	if l.TableSize == 0 {
+		l.TableSize = 2 << 20
+	}
+
+	var levels [][]TableInfo
+	for _, t := range tables {
+		for len(levels) <= t.Level+1 {
+			levels = append(levels, nil)
+		}
+		levels[t.Level] = append(levels[t.Level], t)
+	}
+	if len(levels) == 0 {
+		return Compaction{}, false
+	}
+	if len(levels[0]) >= l.L0Tables {
+		return l.compaction(levels[0], levels[1], 1), true
+	}
+	limit := l.L1Size
+	for level := 1; level+1 < len(levels); level++ {
+		var size int64
+		for _, t := range levels[level] {
+			size += t.Size
+		}
+		if size > limit {
+			// the segment that rewrites the least of the next level
+			next := levels[level+1]
+			best := slices.MinFunc(levels[level], func(a, b TableInfo) int {
+				return cmp.Compare(overlapSize(a, next), overlapSize(b, next))
+			})
+			return l.compaction([]TableInfo{best}, next, level+1), true
+		}
+		limit *= int64(l.Ratio)
+	}
+	return Compaction{}, false
+}
+
+// compaction merges the inputs with the segments of next that overlap them
+func (l Leveled) compaction(inputs, next []TableInfo, level int) Compaction {
+	c := Compaction{Level: level, TableSize: l.TableSize}
+	first, last := inputs[0].First, inputs[0].Last
+	for _, t := range inputs {
+		c.Inputs = append(c.Inputs, t.Num)
+		first, last = min(first, t.First), max(last, t.Last)
+	}
+	for _, t := range next {
+		if t.overlaps(first, last) {
+			c.Inputs = append(c.Inputs, t.Num)
+		}
+	}
+	return c
+}
+
+func overlapSize(t TableInfo, tables []TableInfo) int64 {
+	var size int64
+	for _, u := range tables {
+		if u.overlaps(t.First, t.Last) {
+			size += u.Size
+		}
+	}
+	return size
+}
+
+// SizeTiered is a CompactionStrategy that merges a run of MinTables or more
+// segments of about the same size, which are next to each other in age.
+// Segments above level 0 are left alone.
+type SizeTiered struct {
+	MinTables int // defaults to 4
+
+	// Ratio is how many times bigger the largest segment of a run may be
+	// than the smallest; defaults to 2
+	Ratio float64
+}
+
+func (s SizeTiered) Pick(tables []TableInfo) (Compaction, bool) {
+	if s.MinTables == 0 {
+		s.MinTables = 4
+	}
+	if s.Ratio == 0 {
+		s.Ratio = 2
+	}
+	var l0 []TableInfo
+	for _, t := range tables {
+		if t.Level == 0 {
+			l0 = append(l0, t)
+		}
+	}
+	for i := range l0 {
+		smallest, largest := l0[i].Size, l0[i].Size
+		j := i + 1
+		for ; j < len(l0); j++ {
+			lo, hi := min(smallest, l0[j].Size), max(largest, l0[j].Size)
+			if float64(hi) > s.Ratio*float64(lo) {
+				break
+			}
+			smallest, largest = lo, hi
+		}
+		if j-i >= s.MinTables {
+			c := Compaction{}
+			for _, t := range l0[i:j] {
+				c.Inputs = append(c.Inputs, t.Num)
+			}
+			return c, true
+		}
+	}
+	return Compaction{}, false
+}
+
+// Compact runs the compaction picked by Options.Compaction, and returns false
+// if there's none to run. Reads and writes go on while the segments are
+// merged.
+func (db *DB) Compact() (CompactionStats, bool, error) {
+	db.compacting.Lock()
+	defer db.compacting.Unlock()
+
+	db.mu.RLock()
+	tables := slices.Clone(db.segments)
+	db.mu.RUnlock()
+
+	var infos []TableInfo
+	for _, t := range tables {
+		infos = append(infos, TableInfo{Num: t.num, Level: t.level, Size: t.size, First: t.first, Last: t.last})
+	}
+	c, ok := db.opts.Compaction.Pick(infos)
+	if !ok {
+		return CompactionStats{}, false, nil
+	}
+	inputs, out, bottom, err := plan(tables, c)
+	if err != nil {
+		return CompactionStats{}, false, err
+	}
+	stats := CompactionStats{Level: c.Level, Inputs: len(inputs)}
+	for _, t := range inputs {
+		stats.BytesRead += t.size
+	}
+
+	outputs, err := db.mergeTables(inputs, out, bottom, c.TableSize)
+	if err != nil {
+		return CompactionStats{}, false, err
+	}
+	stats.Outputs = len(outputs)
+	for _, t := range outputs {
+		stats.BytesWritten += t.size
+	}
+
+	db.mu.Lock()
+	segments := slices.DeleteFunc(slices.Clone(db.segments), func(t *table) bool {
+		return slices.Contains(inputs, t)
+	})
+	segments = append(segments, outputs...)
+	sortTables(segments)
+	if err := writeManifest(db.dir, segments); err != nil {
+		db.mu.Unlock()
+		for _, t := range outputs {
+			t.obsolete = true
+			t.release()
+		}
+		return CompactionStats{}, false, err
+	}
+	db.segments = segments
+	db.compacted += stats.BytesWritten
+	if db.flushed > 0 {
+		stats.WriteAmp = float64(db.flushed+db.compacted) / float64(db.flushed)
+	}
+	stats.SpaceAmp = spaceAmp(segments)
+	db.mu.Unlock()
+
+	// scans may still read the inputs; the last one to finish closes and
+	// removes them
+	for _, t := range inputs {
+		t.obsolete = true
+		if err := t.release(); err != nil {
+			return stats, true, err
+		}
+	}
+	return stats, true, nil
+}
+
+// plan finds the inputs of c among the tables, and where the merged records
+// go in the order tables are read. Each table that overlaps an input must
+// stay on the same side of the merged records as of the inputs it overlaps.
+// bottom is set if no older table overlaps the inputs.
+func plan(tables []*table, c Compaction) (inputs []*table, out *table, bottom bool, err error) {
+	for _, num := range c.Inputs {
+		i := slices.IndexFunc(tables, func(t *table) bool { return t.num == num })
+		if i < 0 {
+			return nil, nil, false, fmt.Errorf("%w: no segment %s", ErrBadCompaction, segmentName(num))
+		}
+		inputs = append(inputs, tables[i])
+	}
+	if len(inputs) == 0 {
+		return nil, nil, false, fmt.Errorf("%w: no inputs", ErrBadCompaction)
+	}
+
+	out = &table{level: c.Level, first: inputs[0].first, last: inputs[0].last}
+	for _, t := range inputs {
+		out.seq = max(out.seq, t.seq)
+		out.first, out.last = min(out.first, t.first), max(out.last, t.last)
+	}
+	bottom = true
+	for _, t := range tables {
+		if slices.Contains(inputs, t) {
+			continue
+		}
+		overlaps := false
+		newer, older := before(t, out), before(out, t)
+		for _, in := range inputs {
+			if t.overlaps(in.first, in.last) {
+				overlaps = true
+				newer = newer && before(t, in)
+				older = older && before(in, t)
+			}
+		}
+		if !overlaps {
+			continue
+		}
+		if !newer && !older {
+			return nil, nil, false, ErrBadCompaction
+		}
+		bottom = bottom && newer
+	}
+	return inputs, out, bottom, nil
+}
+
+// mergeTables merges the inputs into new segment files like out, of about
+// size bytes each
+func (db *DB) mergeTables(inputs []*table, out *table, bottom bool, size int64) ([]*table, error) {
+	var segments []*Segment
+	for _, t := range inputs {
+		segments = append(segments, t.Segment)
+	}
+	var outputs []*table
+	var w *tableWriter
+	finish := func() error {
+		t, err := w.finish()
+		w = nil
+		if err != nil {
+			return err
+		}
+		t.level, t.seq = out.level, out.seq
+		outputs = append(outputs, t)
+		return nil
+	}
+	err := merge(segments, bottom, func(r Record) error {
+		if w == nil {
+			db.mu.Lock()
+			num := db.next
+			db.next++
+			db.mu.Unlock()
+			var err error
+			if w, err = db.createTable(num); err != nil {
+				return err
+			}
+		}
+		if err := w.Add(r); err != nil {
+			return err
+		}
+		if size > 0 && int64(w.offset) >= size {
+			return finish()
+		}
+		return nil
+	})
+	if err == nil && w != nil {
+		err = finish()
+	}
+	if err != nil {
+		if w != nil {
+			w.abort()
+		}
+		for _, t := range outputs {
+			t.obsolete = true
+			t.release()
+		}
+		return nil, err
+	}
+	return outputs, nil
+}
+
+// spaceAmp returns the SpaceAmp of CompactionStats for the tables
+func spaceAmp(tables []*table) float64 {
+	var total, largest int64
+	levels := map[int]int64{}
+	for _, t := range tables {
+		total += t.size
+		if t.level == 0 {
+			largest = max(largest, t.size)
+		} else {
+			levels[t.level] += t.size
+			largest = max(largest, levels[t.level])
+		}
+	}
+	if largest == 0 {
+		return 0
+	}
+	return float64(total) / float64(largest)
+}
+
+// SpaceAmp is the size of the keys and values of all records in the
+// segments, over that of the newest record of each key that isn't deleted;
+// 0 if there are none. Unlike the SpaceAmp of CompactionStats, it's exact,
+// and reads every segment.
+func (db *DB) SpaceAmp() (float64, error) {
+	db.mu.RLock()
+	tables := slices.Clone(db.segments)
+	for _, t := range tables {
+		t.acquire()
+	}
+	db.mu.RUnlock()
+	defer func() {
+		for _, t := range tables {
+			t.release()
+		}
+	}()
+
+	var segments []*Segment
+	var total, live int
+	for _, t := range tables {
+		segments = append(segments, t.Segment)
+		it := t.Iter()
+		for it.Next() {
+			total += len(it.Record().Key) + len(it.Record().Value)
+		}
+		if err := it.Err(); err != nil {
+			return 0, err
+		}
+	}
+	err := merge(segments, true, func(r Record) error {
+		live += len(r.Key) + len(r.Value)
+		return nil
+	})
+	if err != nil || live == 0 {
+		return 0, err
+	}
+	return float64(total) / float64(live), nil
+}
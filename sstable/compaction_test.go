@@ -0,0 +1,300 @@
+package sstable
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"slices"
+	"testing"
+)
+
+// strategyFunc is a CompactionStrategy made of a function
+type strategyFunc func(tables []TableInfo) (Compaction, bool)
+
+func (f strategyFunc) Pick(tables []TableInfo) (Compaction, bool) { return f(tables) }
+
+// mergeAll merges every segment into one at level 1
+var mergeAll = strategyFunc(func(tables []TableInfo) (Compaction, bool) {
+	if len(tables) < 2 {
+		return Compaction{}, false
+	}
+	c := Compaction{Level: 1}
+	for _, t := range tables {
+		c.Inputs = append(c.Inputs, t.Num)
+	}
+	return c, true
+})
+
+func TestLeveledPick(t *testing.T) {
+	l := Leveled{L0Tables: 2, L1Size: 100, Ratio: 10, TableSize: 50}
+
+	l0 := []TableInfo{
+		{Num: 5, Level: 0, Size: 10, First: "c", Last: "e"},
+		{Num: 4, Level: 0, Size: 10, First: "d", Last: "f"},
+	}
+	l1 := []TableInfo{
+		{Num: 1, Level: 1, Size: 40, First: "a", Last: "b"},
+		{Num: 2, Level: 1, Size: 40, First: "c", Last: "d"},
+		{Num: 3, Level: 1, Size: 40, First: "e", Last: "g"},
+	}
+	l2 := []TableInfo{
+		{Num: 6, Level: 2, Size: 40, First: "a", Last: "a"},
+		{Num: 7, Level: 2, Size: 900, First: "c", Last: "f"},
+	}
+
+	for _, tc := range []struct {
+		name   string
+		tables []TableInfo
+		want   Compaction
+		ok     bool
+	}{
+		{"empty", nil, Compaction{}, false},
+		{"one l0", l0[:1], Compaction{}, false},
+		{"l0 into l1", slices.Concat(l0, l1), Compaction{Inputs: []int{5, 4, 2, 3}, Level: 1, TableSize: 50}, true},
+		{"l1 into l2", slices.Concat(l0[:1], l1, l2), Compaction{Inputs: []int{1, 6}, Level: 2, TableSize: 50}, true},
+		{"l1 fits", slices.Concat(l1[:2], l2), Compaction{}, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, ok := l.Pick(tc.tables)
+			if ok != tc.ok || !slices.Equal(got.Inputs, tc.want.Inputs) || got.Level != tc.want.Level || got.TableSize != tc.want.TableSize {
+				t.Fatalf("got %+v, %t; want %+v, %t", got, ok, tc.want, tc.ok)
+			}
+		})
+	}
+}
+
+func TestSizeTieredPick(t *testing.T) {
+	s := SizeTiered{MinTables: 3, Ratio: 2}
+	tables := func(sizes ...int64) []TableInfo {
+		var res []TableInfo
+		for i, size := range sizes {
+			res = append(res, TableInfo{Num: i, Size: size})
+		}
+		return res
+	}
+	for _, tc := range []struct {
+		tables []TableInfo
+		want   []int
+	}{
+		{tables(10, 10), nil},
+		{tables(10, 12, 11), []int{0, 1, 2}},
+		{tables(10, 100, 120, 150, 90, 10), []int{1, 2, 3, 4}},
+		{tables(10, 100, 10, 100, 10), nil},
+		{append(tables(10, 10), TableInfo{Num: 9, Level: 1, Size: 10}), nil},
+	} {
+		got, ok := s.Pick(tc.tables)
+		if ok != (tc.want != nil) || !slices.Equal(got.Inputs, tc.want) || got.Level != 0 {
+			t.Errorf("Pick(%v) = %+v, %t; want %v", tc.tables, got, ok, tc.want)
+		}
+	}
+}
+
+func TestCompaction(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		strategy    CompactionStrategy
+		compression Compression
+	}{
+		{"leveled", Leveled{L0Tables: 4, L1Size: 2 << 10, Ratio: 4, TableSize: 1 << 10}, nil},
+		{"size tiered", SizeTiered{}, Flate{}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			opts := Options{BlockSize: 128, MemtableSize: 512, Compaction: tc.strategy, Compression: tc.compression}
+			db, err := OpenDB(dir, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			model := map[string]string{}
+			rng := rand.New(rand.NewSource(1))
+			runs := 0
+			var last CompactionStats
+			for i := range 5000 {
+				key := fmt.Sprintf("key%03d", rng.Intn(200))
+				if rng.Intn(4) == 0 {
+					err = db.Delete(key)
+					delete(model, key)
+				} else {
+					value := fmt.Sprintf("value %d", i)
+					err = db.Put(key, []byte(value))
+					model[key] = value
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				if i%50 == 0 {
+					for {
+						stats, ok, err := db.Compact()
+						if err != nil {
+							t.Fatal(err)
+						}
+						if !ok {
+							break
+						}
+						runs++
+						last = stats
+					}
+				}
+				if i%1000 == 0 {
+					expectModel(t, db, model, rng)
+				}
+			}
+			expectModel(t, db, model, rng)
+			if runs == 0 {
+				t.Fatalf("no compactions")
+			}
+			if last.WriteAmp <= 1 || last.SpaceAmp < 1 {
+				t.Errorf("amplification is off: %+v", last)
+			}
+			t.Logf("%d runs; %d segments; last run %+v", runs, len(db.segments), last)
+
+			if _, ok := tc.strategy.(Leveled); ok {
+				for _, a := range db.segments {
+					for _, b := range db.segments {
+						if a != b && a.level > 0 && a.level == b.level && a.overlaps(b.first, b.last) {
+							t.Fatalf("%s and %s overlap at level %d", segmentName(a.num), segmentName(b.num), a.level)
+						}
+					}
+				}
+			}
+
+			// the replaced segments are gone, and the rest survive reopening
+			if err := db.Close(); err != nil {
+				t.Fatal(err)
+			}
+			entries, err := os.ReadDir(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			manifest, _, err := readManifest(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != len(manifest)+1 {
+				t.Errorf("%d files for %d segments", len(entries), len(manifest))
+			}
+			db, err = OpenDB(dir, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+			expectModel(t, db, model, rng)
+		})
+	}
+}
+
+func TestCompactionTombstones(t *testing.T) {
+	dir := t.TempDir()
+	db, err := OpenDB(dir, Options{BlockSize: 128, MemtableSize: 512, Compaction: mergeAll})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for i := range 500 {
+		key := fmt.Sprintf("key%03d", i%100)
+		if i%3 == 0 {
+			err = db.Delete(key)
+		} else {
+			err = db.Put(key, []byte("value"))
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	stats, ok, err := db.Compact()
+	if err != nil || !ok {
+		t.Fatalf("Compact() = %t, %v", ok, err)
+	}
+	if stats.Outputs != 1 || len(db.segments) != 1 {
+		t.Fatalf("got %d segments", len(db.segments))
+	}
+	if stats.SpaceAmp != 1 {
+		t.Errorf("estimated space amplification after a full merge is %f", stats.SpaceAmp)
+	}
+	if amp, err := db.SpaceAmp(); err != nil || amp != 1 {
+		t.Errorf("space amplification after a full merge is %f, %v", amp, err)
+	}
+	for _, r := range records(t, db.segments[0].Segment) {
+		if r.Tombstone {
+			t.Fatalf("tombstone of %s kept at the bottom", r.Key)
+		}
+	}
+}
+
+// A scan keeps reading the segments that are compacted away under it, and
+// the last one done with a segment closes and removes it
+func TestCompactionScan(t *testing.T) {
+	db, err := OpenDB(t.TempDir(), Options{BlockSize: 128, MemtableSize: 512, Compaction: mergeAll})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for i := range 300 {
+		if err := db.Put(fmt.Sprintf("key%03d", i), []byte("value")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	inputs := slices.Clone(db.segments)
+	if len(inputs) < 2 {
+		t.Fatalf("got %d segments", len(inputs))
+	}
+
+	it := db.Scan("", "")
+	stopped := db.Scan("", "")
+	if !it.Next() || !stopped.Next() {
+		t.Fatalf("empty scan")
+	}
+	if _, ok, err := db.Compact(); err != nil || !ok {
+		t.Fatalf("Compact() = %t, %v", ok, err)
+	}
+	for _, in := range inputs {
+		if _, err := os.Stat(in.path); err != nil {
+			t.Fatalf("%s is gone while scans read it: %v", segmentName(in.num), err)
+		}
+	}
+	if err := stopped.Close(); err != nil {
+		t.Fatal(err)
+	}
+	n := 1
+	for it.Next() {
+		n++
+	}
+	if err := it.Err(); err != nil || n != 300 {
+		t.Fatalf("scan got %d records, %v", n, err)
+	}
+	for _, in := range inputs {
+		if _, err := os.Stat(in.path); !os.IsNotExist(err) {
+			t.Errorf("%s is still there after the scans: %v", segmentName(in.num), err)
+		}
+		if err := in.f.Close(); !errors.Is(err, os.ErrClosed) {
+			t.Errorf("%s is still open after the scans", segmentName(in.num))
+		}
+	}
+}
+
+func TestCompactionReorder(t *testing.T) {
+	dir := t.TempDir()
+	// merges the newest and the oldest segment, which overlap the middle one
+	strategy := strategyFunc(func(tables []TableInfo) (Compaction, bool) {
+		return Compaction{Inputs: []int{tables[0].Num, tables[len(tables)-1].Num}}, true
+	})
+	db, err := OpenDB(dir, Options{Compaction: strategy})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for i := range 3 {
+		db.Put("a", []byte{byte(i)})
+		db.Put("b", []byte{byte(i)})
+		db.mu.Lock()
+		err := db.flush()
+		db.mu.Unlock()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, _, err := db.Compact(); !errors.Is(err, ErrBadCompaction) {
+		t.Fatalf("got %v, want ErrBadCompaction", err)
+	}
+}
@@ -0,0 +1,82 @@
+package sstable
+
+import (
+	"bytes"
+	"compress/flate"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// Compression compresses data blocks. A segment file records the ID of the
+// compression of each block, so it can be read with any Options, as long as
+// the compression is registered.
+type Compression interface {
+	// ID identifies the compression in segment files. 0 is taken by no
+	// compression.
+	ID() byte
+
+	// Compress appends the compressed src to dst
+	Compress(dst, src []byte) []byte
+
+	// Decompress appends the decompressed src to dst
+	Decompress(dst, src []byte) ([]byte, error)
+}
+
+var (
+	compressionsMu sync.RWMutex
+	compressions   = map[byte]Compression{}
+)
+
+// RegisterCompression makes c available for reading segment files. It
+// panics if the ID of c is taken.
+func RegisterCompression(c Compression) {
+	compressionsMu.Lock()
+	defer compressionsMu.Unlock()
+	if _, ok := compressions[c.ID()]; ok || c.ID() == 0 {
+		panic(fmt.Sprintf("sstable: compression %d is registered twice", c.ID()))
+	}
+	compressions[c.ID()] = c
+}
+
+func compression(id byte) (Compression, bool) {
+	compressionsMu.RLock()
+	defer compressionsMu.RUnlock()
+	c, ok := compressions[id]
+	return c, ok
+}
+
+func init() {
+	RegisterCompression(Flate{})
+}
+
+// Flate is Compression with compress/flate
+type Flate struct {
+	Level int // a flate level; 0 means flate.DefaultCompression
+}
+
+func (Flate) ID() byte { return 1 }
+
+func (c Flate) Compress(dst, src []byte) []byte {
+	level := c.Level
+	if level == 0 {
+		level = flate.DefaultCompression
+	}
+	buf := bytes.NewBuffer(dst)
+	w, err := flate.NewWriter(buf, level)
+	if err != nil {
+		panic(err)
+	}
+	// writes to a bytes.Buffer don't fail
+	w.Write(src)
+	w.Close()
+	return buf.Bytes()
+}
+
+func (Flate) Decompress(dst, src []byte) ([]byte, error) {
+	buf := bytes.NewBuffer(dst)
+	if _, err := io.Copy(buf, flate.NewReader(bytes.NewReader(src))); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
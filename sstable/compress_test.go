@@ -0,0 +1,149 @@
+package sstable
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// reverse is a Compression that isn't registered
+type reverse struct{}
+
+func (reverse) ID() byte { return 200 }
+func (reverse) Compress(dst, src []byte) []byte {
+	for i := len(src) - 1; i >= 0; i-- {
+		dst = append(dst, src[i])
+	}
+	return dst[:len(dst)-len(src)/2]
+}
+func (reverse) Decompress(dst, src []byte) ([]byte, error) { return append(dst, src...), nil }
+
+func TestCompression(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	var text, noise []Record
+	for i := range 1000 {
+		key := fmt.Sprintf("key%05d", i)
+		text = append(text, rec(key, fmt.Sprintf("the value of %s is %d", key, i%7)))
+		value := make([]byte, 40)
+		rng.Read(value)
+		noise = append(noise, NewRecord(key, value))
+	}
+	for _, tc := range []struct {
+		name  string
+		input []Record
+		// size with Flate over size without
+		maxRatio float64
+	}{
+		{"text", text, 0.5},
+		{"noise", noise, 1},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			plain := write(t, Options{BlockSize: 1024}, tc.input...)
+			b := write(t, Options{BlockSize: 1024, Compression: Flate{}}, tc.input...)
+			ratio := float64(len(b)) / float64(len(plain))
+			t.Logf("%d bytes with Flate, %d without", len(b), len(plain))
+			if ratio > tc.maxRatio {
+				t.Errorf("Flate makes the segment %.2f times the size", ratio)
+			}
+			s, err := Open(bytes.NewReader(b), int64(len(b)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			expectRecords(t, tc.input, records(t, s))
+			for _, r := range tc.input[:100] {
+				if got, ok, err := s.Get(r.Key); err != nil || !ok || !bytes.Equal(got.Value, r.Value) {
+					t.Fatalf("Get(%q) = %q, %t, %v", r.Key, got.Value, ok, err)
+				}
+			}
+		})
+	}
+
+	b := write(t, Options{Compression: reverse{}}, text...)
+	s, err := Open(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := s.Get("key00001"); !errors.Is(err, ErrUnknownCompression) {
+		t.Errorf("got %v, want ErrUnknownCompression", err)
+	}
+}
+
+// Flipping any bit before the footer is caught by a checksum
+func TestCorruption(t *testing.T) {
+	var input []Record
+	for i := range 100 {
+		input = append(input, rec(fmt.Sprintf("key%03d", i), fmt.Sprint(i)))
+	}
+	for _, c := range []Compression{nil, Flate{}} {
+		good := write(t, Options{BlockSize: 128, Compression: c}, input...)
+		s, err := Open(bytes.NewReader(good), int64(len(good)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		// the block with the byte at i
+		blockAt := func(i int) uint64 {
+			for _, h := range s.index {
+				if h.offset <= uint64(i) && uint64(i) < h.offset+h.length {
+					return h.offset
+				}
+			}
+			t.Fatalf("byte %d is in no data block", i)
+			return 0
+		}
+		end := int(s.index[len(s.index)-1].offset + s.index[len(s.index)-1].length)
+
+		for i := range len(good) - footerSize {
+			b := bytes.Clone(good)
+			b[i] ^= 1 << (i % 8)
+			s, err := Open(bytes.NewReader(b), int64(len(b)))
+			var corrupt *CorruptionError
+			if i >= end {
+				// the filter or index block
+				if !errors.As(err, &corrupt) || corrupt.Offset < uint64(end) {
+					t.Fatalf("flipped byte %d of the filter or index, and Open returned %v", i, err)
+				}
+				continue
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			it := s.Iter()
+			for it.Next() {
+			}
+			if !errors.As(it.Err(), &corrupt) || !errors.Is(it.Err(), ErrCorruption) {
+				t.Fatalf("flipped byte %d, and Iter returned %v", i, it.Err())
+			}
+			if want := blockAt(i); corrupt.Offset != want {
+				t.Fatalf("flipped byte %d, and got offset %d; want %d", i, corrupt.Offset, want)
+			}
+		}
+	}
+}
+
+func TestCorruptionSegment(t *testing.T) {
+	path := filepath.Join(t.TempDir(), segmentName(1))
+	b := write(t, Options{}, rec("a", "1"), rec("b", "2"))
+	b[0] ^= 0xff
+	if err := os.WriteFile(path, b, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	s, err := Open(f, int64(len(b)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = s.Get("a")
+	var corrupt *CorruptionError
+	if !errors.As(err, &corrupt) || corrupt.Segment != path || corrupt.Offset != 0 {
+		t.Fatalf("got %v, want a CorruptionError for %s", err, path)
+	}
+	t.Log(err)
+}
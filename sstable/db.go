@@ -0,0 +1,448 @@
+package sstable
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"sync/atomic"
+
+	"github.com/kvalv/algos/rb"
+)
+
+// LSM trees
+//
+// A DB keeps its newest records in a memtable, which is a red-black tree. Once
+// the records there take up Options.MemtableSize bytes, they're written to a
+// new segment file, and the memtable starts over. Segments are never changed
+// once they're written.
+//
+// Deletes are records too, called tombstones, since the older records of a
+// key may be in a segment. Reads go from the memtable to the segments, newest
+// first, and stop at the first record of the key.
+//
+// The memtable is only written to disk when it's full, or when the DB is
+// closed, so records in it are lost on a crash.
+//
+// Segments are merged by Compact; see compaction.go. A merged segment holds
+// records as old as those of the segments it replaced, so segments are read
+// by level, and then by seq, which is the largest number of a segment file
+// whose records went into it. Levels and seqs are kept in the manifest; see
+// manifest.go.
+//
+// A segment file is reference counted. The DB holds a reference while the
+// segment is in use, and each scan holds one until it's done, so a segment
+// that's compacted away stays open for the scans that still read it. The file
+// is closed, and removed if it was compacted away, on the last release.
+
+const DefaultMemtableSize = 4 << 20
+
+// DB is a key-value store on segment files in a directory. It is safe for
+// concurrent use.
+type DB struct {
+	dir  string
+	opts Options
+
+	mu        sync.RWMutex
+	mem       *rb.TreeOf[string, Record]
+	memSize   int
+	segments  []*table // in the order they're read
+	next      int      // number of the next segment file
+	flushed   int64    // bytes written by flushes
+	compacted int64    // bytes written by compactions
+
+	compacting sync.Mutex // held by Compact
+
+	gets, segmentsRead, segmentsSkipped atomic.Int64
+}
+
+// Stats counts the work done by the Gets of a DB
+type Stats struct {
+	Gets int64
+
+	// SegmentsRead is the number of segments a Get read a block of
+	SegmentsRead int64
+
+	// SegmentsSkipped is the number of segments a Get didn't read, since
+	// their Bloom filter ruled out the key
+	SegmentsSkipped int64
+}
+
+// table is an open segment file
+type table struct {
+	*Segment
+	f           *os.File
+	path        string
+	num         int
+	level, seq  int
+	size        int64
+	first, last string
+
+	refs     atomic.Int32
+	obsolete bool // set before the DB's reference is released by Compact
+}
+
+func (t *table) acquire() { t.refs.Add(1) }
+
+// release drops a reference, and closes the file on the last one. An obsolete
+// file is removed too; if that fails, it's removed when the DB is opened
+// again.
+func (t *table) release() error {
+	if t.refs.Add(-1) > 0 {
+		return nil
+	}
+	err := t.f.Close()
+	if t.obsolete {
+		os.Remove(t.path)
+	}
+	return err
+}
+
+func (t *table) overlaps(first, last string) bool {
+	return t.first <= last && first <= t.last
+}
+
+// before reports whether t is read before u
+func before(t, u *table) bool {
+	return t.level < u.level || t.level == u.level && t.seq > u.seq
+}
+
+func sortTables(tables []*table) {
+	slices.SortFunc(tables, func(t, u *table) int {
+		if before(t, u) {
+			return -1
+		}
+		if before(u, t) {
+			return 1
+		}
+		return 0
+	})
+}
+
+func segmentName(num int) string { return fmt.Sprintf("%06d.sst", num) }
+
+// OpenDB opens the DB in dir, which is created if it doesn't exist
+func OpenDB(dir string, opts Options) (*DB, error) {
+	if opts.MemtableSize == 0 {
+		opts.MemtableSize = DefaultMemtableSize
+	}
+	if opts.Compaction == nil {
+		opts.Compaction = Leveled{}
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	manifest, ok, err := readManifest(dir)
+	if err != nil {
+		return nil, err
+	}
+	listed := map[int]manifestEntry{}
+	for _, e := range manifest {
+		listed[e.num] = e
+	}
+
+	db := &DB{dir: dir, opts: opts, mem: &rb.TreeOf[string, Record]{}}
+	for _, e := range entries {
+		var num int
+		if _, err := fmt.Sscanf(e.Name(), "%06d.sst", &num); err != nil || e.Name() != segmentName(num) && e.Name() != segmentName(num)+".tmp" {
+			continue
+		}
+		db.next = max(db.next, num+1)
+		m, inManifest := listed[num]
+		if e.Name() != segmentName(num) || ok && !inManifest {
+			// left over from a flush or compaction that didn't finish
+			if err := os.Remove(filepath.Join(dir, e.Name())); err != nil {
+				db.Close()
+				return nil, err
+			}
+			continue
+		}
+		if !ok {
+			m = manifestEntry{num: num, seq: num}
+		}
+		t, err := db.openTable(m.num, m.level, m.seq)
+		if err != nil {
+			db.Close()
+			return nil, err
+		}
+		db.segments = append(db.segments, t)
+	}
+	if len(db.segments) != len(manifest) && ok {
+		db.Close()
+		return nil, fmt.Errorf("sstable: segments listed in the manifest are missing")
+	}
+	sortTables(db.segments)
+	return db, nil
+}
+
+func (db *DB) openTable(num, level, seq int) (*table, error) {
+	f, err := os.Open(filepath.Join(db.dir, segmentName(num)))
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	s, err := Open(f, info.Size())
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%s: %w", segmentName(num), err)
+	}
+	first, last, err := s.bounds()
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%s: %w", segmentName(num), err)
+	}
+	t := &table{Segment: s, f: f, path: f.Name(), num: num, level: level, seq: seq, size: info.Size(), first: first, last: last}
+	t.acquire()
+	return t, nil
+}
+
+// tableWriter writes a segment file under a temporary name
+type tableWriter struct {
+	*Writer
+	db   *DB
+	f    *os.File
+	num  int
+	path string
+}
+
+func (db *DB) createTable(num int) (*tableWriter, error) {
+	path := filepath.Join(db.dir, segmentName(num))
+	f, err := os.Create(path + ".tmp")
+	if err != nil {
+		return nil, err
+	}
+	return &tableWriter{Writer: NewWriter(f, db.opts), db: db, f: f, num: num, path: path}, nil
+}
+
+// finish closes the file, renames it, and opens it as a table at level 0
+func (w *tableWriter) finish() (*table, error) {
+	err := w.Close()
+	if err == nil {
+		err = w.f.Sync()
+	}
+	if cerr := w.f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(w.path+".tmp", w.path)
+	}
+	if err != nil {
+		os.Remove(w.path + ".tmp")
+		return nil, err
+	}
+	t, err := w.db.openTable(w.num, 0, w.num)
+	if err != nil {
+		os.Remove(w.path)
+		return nil, err
+	}
+	return t, nil
+}
+
+func (w *tableWriter) abort() {
+	w.f.Close()
+	os.Remove(w.path + ".tmp")
+}
+
+func (db *DB) Put(key string, value []byte) error {
+	return db.add(NewRecord(key, bytes.Clone(value)))
+}
+
+func (db *DB) Delete(key string) error {
+	return db.add(NewTombstone(key))
+}
+
+func (db *DB) add(r Record) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.mem.Put(r.Key, r)
+	db.memSize += len(r.Key) + len(r.Value)
+	if db.memSize < db.opts.MemtableSize {
+		return nil
+	}
+	return db.flush()
+}
+
+// flush writes the memtable to a new segment. The file is written under a
+// temporary name, and renamed once it's complete. db.mu must be held.
+func (db *DB) flush() error {
+	if db.mem.Root == nil {
+		return nil
+	}
+	w, err := db.createTable(db.next)
+	if err != nil {
+		return err
+	}
+	db.next++
+	for _, n := range db.mem.All() {
+		if err := w.Add(n.Value); err != nil {
+			w.abort()
+			return err
+		}
+	}
+	t, err := w.finish()
+	if err != nil {
+		return err
+	}
+	segments := slices.Insert(slices.Clone(db.segments), 0, t)
+	if err := writeManifest(db.dir, segments); err != nil {
+		t.obsolete = true
+		t.release()
+		return err
+	}
+	db.segments = segments
+	db.flushed += t.size
+	db.mem, db.memSize = &rb.TreeOf[string, Record]{}, 0
+	return nil
+}
+
+// Get returns the value of key, and false if there's none
+func (db *DB) Get(key string) ([]byte, bool, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	db.gets.Add(1)
+	if n := db.mem.Find(key); n != nil {
+		return n.Value.Value, !n.Value.Tombstone, nil
+	}
+	for _, t := range db.segments {
+		if key < t.first || key > t.last {
+			continue
+		}
+		if !t.mayContain(key) {
+			db.segmentsSkipped.Add(1)
+			continue
+		}
+		db.segmentsRead.Add(1)
+		r, ok, err := t.Get(key)
+		if err != nil {
+			return nil, false, err
+		}
+		if ok {
+			return r.Value, !r.Tombstone, nil
+		}
+	}
+	return nil, false, nil
+}
+
+func (db *DB) Stats() Stats {
+	return Stats{
+		Gets:            db.gets.Load(),
+		SegmentsRead:    db.segmentsRead.Load(),
+		SegmentsSkipped: db.segmentsSkipped.Load(),
+	}
+}
+
+// Scan returns an iterator over the records with keys in [lo, hi), in key
+// order. An empty hi has no upper bound. Changes made while scanning may or
+// may not be seen. The segments it reads stay open until Next returns false,
+// so a scan that's stopped early must be closed.
+func (db *DB) Scan(lo, hi string) *ScanIterator {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	// the memtable is small, so the records in range are copied
+	mem := &sliceIterator{}
+	for _, n := range db.mem.Ascend(lo) {
+		if hi != "" && n.Key >= hi {
+			break
+		}
+		mem.records = append(mem.records, n.Value)
+	}
+	its := []Iterator{mem}
+	for _, t := range db.segments {
+		t.acquire()
+		its = append(its, t.IterFrom(lo))
+	}
+	return &ScanIterator{m: newMergeIterator(its...), tables: slices.Clone(db.segments), lo: lo, hi: hi}
+}
+
+// ScanIterator is the Iterator of DB.Scan. It skips the records outside
+// [lo, hi), and tombstones.
+type ScanIterator struct {
+	m      *mergeIterator
+	tables []*table // released by Close
+	lo, hi string
+	err    error // of Close
+}
+
+func (it *ScanIterator) Next() bool {
+	for it.m.Next() {
+		r := it.m.Record()
+		if it.hi != "" && r.Key >= it.hi {
+			break
+		}
+		if r.Key >= it.lo && !r.Tombstone {
+			return true
+		}
+	}
+	if err := it.Close(); it.err == nil {
+		it.err = err
+	}
+	return false
+}
+
+func (it *ScanIterator) Record() Record { return it.m.Record() }
+
+func (it *ScanIterator) Err() error {
+	if err := it.m.Err(); err != nil {
+		return err
+	}
+	return it.err
+}
+
+// Close releases the segments of the scan. It's done by Next once it returns
+// false, and calling it again does nothing.
+func (it *ScanIterator) Close() error {
+	var err error
+	for _, t := range it.tables {
+		if rerr := t.release(); err == nil {
+			err = rerr
+		}
+	}
+	it.tables = nil
+	return err
+}
+
+// Close writes the memtable to a segment, and releases the segment files.
+// Those that scans still read are closed once the scans are done.
+func (db *DB) Close() error {
+	db.compacting.Lock()
+	defer db.compacting.Unlock()
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	err := db.flush()
+	for _, t := range db.segments {
+		if rerr := t.release(); err == nil {
+			err = rerr
+		}
+	}
+	db.segments = nil
+	return err
+}
+
+// sliceIterator goes over records kept in memory
+type sliceIterator struct {
+	records []Record
+	i       int
+}
+
+func (it *sliceIterator) Next() bool {
+	if it.i == len(it.records) {
+		return false
+	}
+	it.i++
+	return true
+}
+
+func (it *sliceIterator) Record() Record { return it.records[it.i-1] }
+func (it *sliceIterator) Err() error     { return nil }
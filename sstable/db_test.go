@@ -0,0 +1,156 @@
+package sstable
+
+import (
+	"fmt"
+	"maps"
+	"math/rand"
+	"os"
+	"slices"
+	"testing"
+)
+
+func openDB(t *testing.T, dir string) *DB {
+	t.Helper()
+	db, err := OpenDB(dir, Options{BlockSize: 128, MemtableSize: 512})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func scan(t *testing.T, db *DB, lo, hi string) []Record {
+	t.Helper()
+	var res []Record
+	it := db.Scan(lo, hi)
+	for it.Next() {
+		res = append(res, it.Record())
+	}
+	if err := it.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return res
+}
+
+// expectModel checks every key, and a few scans, against the model
+func expectModel(t *testing.T, db *DB, model map[string]string, rng *rand.Rand) {
+	t.Helper()
+	for i := range 200 {
+		key := fmt.Sprintf("key%03d", i)
+		v, ok, err := db.Get(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want, inModel := model[key]; ok != inModel || string(v) != want {
+			t.Fatalf("Get(%q) = %q, %t; want %q, %t", key, v, ok, want, inModel)
+		}
+	}
+	for range 10 {
+		lo, hi := fmt.Sprintf("key%03d", rng.Intn(200)), fmt.Sprintf("key%03d", rng.Intn(200))
+		if rng.Intn(5) == 0 {
+			hi = ""
+		}
+		var want []string
+		for _, k := range slices.Sorted(maps.Keys(model)) {
+			if k >= lo && (hi == "" || k < hi) {
+				want = append(want, k+"="+model[k])
+			}
+		}
+		var got []string
+		for _, r := range scan(t, db, lo, hi) {
+			got = append(got, r.Key+"="+string(r.Value))
+		}
+		if !slices.Equal(got, want) {
+			t.Fatalf("Scan(%q, %q);\nwant= %v\ngot = %v", lo, hi, want, got)
+		}
+	}
+}
+
+func TestDB(t *testing.T) {
+	dir := t.TempDir()
+	db := openDB(t, dir)
+	model := map[string]string{}
+	rng := rand.New(rand.NewSource(1))
+
+	for i := range 3000 {
+		key := fmt.Sprintf("key%03d", rng.Intn(200))
+		if rng.Intn(4) == 0 {
+			if err := db.Delete(key); err != nil {
+				t.Fatal(err)
+			}
+			delete(model, key)
+		} else {
+			value := fmt.Sprintf("value %d", i)
+			if err := db.Put(key, []byte(value)); err != nil {
+				t.Fatal(err)
+			}
+			model[key] = value
+		}
+		if i%500 == 0 {
+			expectModel(t, db, model, rng)
+		}
+	}
+	if len(db.segments) < 10 {
+		t.Fatalf("want many segments, got %d", len(db.segments))
+	}
+	expectModel(t, db, model, rng)
+
+	// everything is still there after reopening
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	db = openDB(t, dir)
+	defer db.Close()
+	expectModel(t, db, model, rng)
+}
+
+func TestDBEmpty(t *testing.T) {
+	dir := t.TempDir()
+	db := openDB(t, dir)
+	if _, ok, err := db.Get("a"); ok || err != nil {
+		t.Fatalf("Get on an empty DB = %t, %v", ok, err)
+	}
+	if got := scan(t, db, "", ""); got != nil {
+		t.Fatalf("Scan on an empty DB = %v", got)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Fatalf("closing an empty DB wrote %d files", len(entries))
+	}
+}
+
+func TestDBStats(t *testing.T) {
+	for _, bits := range []int{0, -1} {
+		db, err := OpenDB(t.TempDir(), Options{BlockSize: 128, MemtableSize: 512, BloomBits: bits})
+		if err != nil {
+			t.Fatal(err)
+		}
+		rng := rand.New(rand.NewSource(1))
+		for range 2000 {
+			if err := db.Put(fmt.Sprintf("key%04d", 2*rng.Intn(1000)), []byte("value")); err != nil {
+				t.Fatal(err)
+			}
+		}
+		for i := range 1000 {
+			if _, ok, err := db.Get(fmt.Sprintf("key%04d", 2*i+1)); ok || err != nil {
+				t.Fatalf("Get of a missing key = %t, %v", ok, err)
+			}
+		}
+		stats := db.Stats()
+		t.Logf("%d bits per key, %d segments: %+v", bits, len(db.segments), stats)
+		if stats.Gets != 1000 {
+			t.Errorf("got %d gets, want 1000", stats.Gets)
+		}
+		if bits < 0 {
+			if stats.SegmentsSkipped != 0 {
+				t.Errorf("skipped %d segments without filters", stats.SegmentsSkipped)
+			}
+		} else if stats.SegmentsRead*50 > stats.SegmentsSkipped {
+			t.Errorf("read %d segments, and skipped only %d", stats.SegmentsRead, stats.SegmentsSkipped)
+		}
+		if err := db.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
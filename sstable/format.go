@@ -0,0 +1,201 @@
+package sstable
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+)
+
+// File format
+//
+// A segment file is a run of data blocks, a filter block, an index block and
+// a footer:
+//
+//	[data block 1] ... [data block n] [filter block] [index block] [footer]
+//
+// A data block holds records in key order. Keys share a prefix with the key
+// before them, so each record is stored as
+//
+//	uvarint(shared) uvarint(unshared) uvarint(len(value)<<1 | tombstone) key[shared:] value
+//
+// where shared is the length of the common prefix, and tombstone is 1 for a
+// tombstone. The first record of a block shares nothing, so a block can be
+// read on its own.
+//
+// The filter block is a Bloom filter of the keys; see bloom.go. It's empty
+// if the segment has no filter.
+//
+// The index block has one entry for each data block, in order:
+//
+//	uvarint(len(first key)) first key uvarint(offset) uvarint(length)
+//
+// Each block is followed by a trailer: the ID of its compression, and the
+// CRC32C of the block and the ID as a big-endian uint32. Data blocks are
+// compressed with Options.Compression if that makes them at least an eighth
+// smaller; filter and index blocks aren't compressed. The offsets and lengths
+// of blocks include the trailer.
+//
+// The footer is the offset and length of the filter block, those of the
+// index block, and the magic number, each as a big-endian uint64.
+
+const (
+	magic       = 0x7373_7461_626c_6533 // "sstable3"
+	footerSize  = 40
+	trailerSize = 5
+)
+
+var (
+	ErrUnsorted           = errors.New("sstable: records are not sorted")
+	ErrBadMagic           = errors.New("not an sstable file")
+	ErrUnknownCompression = errors.New("sstable: unknown compression")
+
+	// ErrCorruption is wrapped by a CorruptionError
+	ErrCorruption = errors.New("sstable: corrupt block")
+)
+
+// CorruptionError is returned for a block of a segment file that fails its
+// checksum, or doesn't decode
+type CorruptionError struct {
+	Segment string // name of the file, if it has one
+	Offset  uint64 // of the block
+	Err     error  // what's wrong with the block
+}
+
+func (e *CorruptionError) Error() string {
+	segment := e.Segment
+	if segment == "" {
+		segment = "segment"
+	}
+	return fmt.Sprintf("sstable: corrupt block at offset %d of %s: %v", e.Offset, segment, e.Err)
+}
+func (e *CorruptionError) Unwrap() error { return ErrCorruption }
+
+var (
+	errChecksum  = errors.New("checksum mismatch")
+	errMalformed = errors.New("malformed record")
+)
+
+// blockHandle locates a data block
+type blockHandle struct {
+	first          string // key of the first record
+	offset, length uint64
+}
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// appendBlock appends block, compressed with c unless c is nil, and its
+// trailer to b
+func appendBlock(b, block []byte, c Compression) []byte {
+	start := len(b)
+	var id byte
+	if c != nil {
+		b = c.Compress(b, block)
+		if len(b)-start <= len(block)-len(block)/8 {
+			id = c.ID()
+		} else {
+			b = b[:start]
+		}
+	}
+	if id == 0 {
+		b = append(b, block...)
+	}
+	b = append(b, id)
+	return binary.BigEndian.AppendUint32(b, crc32.Checksum(b[start:], castagnoli))
+}
+
+// decodeBlock checks the trailer of b, and returns the decompressed block.
+// Errors other than ErrUnknownCompression mean b is corrupt.
+func decodeBlock(b []byte) ([]byte, error) {
+	if len(b) < trailerSize {
+		return nil, fmt.Errorf("block of %d bytes is too short", len(b))
+	}
+	n := len(b) - 4
+	if crc32.Checksum(b[:n], castagnoli) != binary.BigEndian.Uint32(b[n:]) {
+		return nil, errChecksum
+	}
+	id, block := b[n-1], b[:n-1:n-1]
+	if id == 0 {
+		return block, nil
+	}
+	c, ok := compression(id)
+	if !ok {
+		return nil, fmt.Errorf("%w %d", ErrUnknownCompression, id)
+	}
+	return c.Decompress(nil, block)
+}
+
+func appendRecord(b []byte, prev string, r Record) []byte {
+	shared := commonPrefix(prev, r.Key)
+	b = binary.AppendUvarint(b, uint64(shared))
+	b = binary.AppendUvarint(b, uint64(len(r.Key)-shared))
+	size := uint64(len(r.Value)) << 1
+	if r.Tombstone {
+		size |= 1
+	}
+	b = binary.AppendUvarint(b, size)
+	b = append(b, r.Key[shared:]...)
+	return append(b, r.Value...)
+}
+
+// decodeRecord decodes the record at the start of b, which follows the
+// record with key prev. It returns the size of the encoded record.
+func decodeRecord(b []byte, prev string) (Record, int, error) {
+	var fields [3]uint64
+	n := 0
+	for i := range fields {
+		v, m := binary.Uvarint(b[n:])
+		if m <= 0 {
+			return Record{}, 0, errMalformed
+		}
+		fields[i] = v
+		n += m
+	}
+	shared, unshared, size := fields[0], fields[1], fields[2]>>1
+	if shared > uint64(len(prev)) || unshared > uint64(len(b)-n) || size > uint64(len(b)-n)-unshared {
+		return Record{}, 0, errMalformed
+	}
+	key := prev[:shared] + string(b[n:n+int(unshared)])
+	n += int(unshared)
+	value := b[n : n+int(size) : n+int(size)]
+	return Record{Key: key, Value: value, Tombstone: fields[2]&1 == 1}, n + int(size), nil
+}
+
+func appendHandle(b []byte, h blockHandle) []byte {
+	b = binary.AppendUvarint(b, uint64(len(h.first)))
+	b = append(b, h.first...)
+	b = binary.AppendUvarint(b, h.offset)
+	return binary.AppendUvarint(b, h.length)
+}
+
+var errMalformedIndex = errors.New("malformed index entry")
+
+func decodeIndex(b []byte) ([]blockHandle, error) {
+	var index []blockHandle
+	for len(b) > 0 {
+		size, n := binary.Uvarint(b)
+		if n <= 0 || size > uint64(len(b)-n) {
+			return nil, errMalformedIndex
+		}
+		h := blockHandle{first: string(b[n : n+int(size)])}
+		b = b[n+int(size):]
+		for _, v := range []*uint64{&h.offset, &h.length} {
+			if *v, n = binary.Uvarint(b); n <= 0 {
+				return nil, errMalformedIndex
+			}
+			b = b[n:]
+		}
+		index = append(index, h)
+	}
+	return index, nil
+}
+
+func commonPrefix(a, b string) int {
+	n := min(len(a), len(b))
+	for i := range n {
+		if a[i] != b[i] {
+			return i
+		}
+	}
+	return n
+}
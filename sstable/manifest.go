@@ -0,0 +1,77 @@
+package sstable
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// The manifest lists the segments of a DB, one per line:
+//
+//	000012.sst <level> <seq>
+//
+// seq orders the segments by the age of their records; see DB. Segment files
+// that aren't listed are left over from a crash, and are removed when the DB
+// is opened. A DB without a manifest has its segments at level 0, with seq
+// taken from the file name.
+
+const manifestName = "MANIFEST"
+
+// manifestEntry is a line of the manifest
+type manifestEntry struct {
+	num, level, seq int
+}
+
+// readManifest reads the manifest in dir, and returns false if there's none
+func readManifest(dir string) ([]manifestEntry, bool, error) {
+	f, err := os.Open(filepath.Join(dir, manifestName))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	defer f.Close()
+
+	var entries []manifestEntry
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		var e manifestEntry
+		if _, err := fmt.Sscanf(sc.Text(), "%06d.sst %d %d", &e.num, &e.level, &e.seq); err != nil {
+			return nil, false, fmt.Errorf("sstable: malformed manifest line %q", sc.Text())
+		}
+		entries = append(entries, e)
+	}
+	return entries, true, sc.Err()
+}
+
+// writeManifest replaces the manifest in dir with one listing the tables. The
+// new manifest is written under a temporary name and renamed.
+func writeManifest(dir string, tables []*table) error {
+	var b strings.Builder
+	for _, t := range tables {
+		fmt.Fprintf(&b, "%s %d %d\n", segmentName(t.num), t.level, t.seq)
+	}
+	path := filepath.Join(dir, manifestName)
+	f, err := os.Create(path + ".tmp")
+	if err != nil {
+		return err
+	}
+	_, err = f.WriteString(b.String())
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(path+".tmp", path)
+	}
+	if err != nil {
+		os.Remove(path + ".tmp")
+	}
+	return err
+}
@@ -0,0 +1,127 @@
+package sstable
+
+import "container/heap"
+
+// K-way merge
+//
+// A merge of k segments reads each of them one block at a time, through an
+// iterator. The iterators are kept on a heap, ordered by the key of their
+// current record and then by age, so the next record is always on top, and
+// the older records of its key come right after it. That's O(log k) per
+// record, and memory for k blocks, however big the segments are.
+//
+// MergeTo is the streaming entry point: it writes the merged records to a
+// Writer as they come, so with a Writer on a file nothing is held in memory.
+// Merge is MergeTo into memory. Compaction and DB.Scan use the same
+// mergeIterator, with the memtable as the newest iterator of a scan.
+
+// Merge returns a segment kept in memory with the newest record of each key
+// in the segments, which are given newest first. Tombstones are kept. The
+// segments are streamed, but the result is built in memory, so segments whose
+// merge doesn't fit there must go through MergeTo. It panics if a segment
+// can't be read.
+func Merge(segments ...*Segment) *Segment {
+	var s *Segment
+	var err error
+	s = fromWriter(func(w *Writer) { err = MergeTo(w, false, segments...) })
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+// MergeTo writes the newest record of each key in the segments, which are
+// given newest first, to w. The segments are read one block at a time, so
+// they need not fit in memory. If bottom is set, there are no older records
+// than those in the segments, so tombstones are dropped. w is not closed.
+func MergeTo(w *Writer, bottom bool, segments ...*Segment) error {
+	return merge(segments, bottom, w.Add)
+}
+
+// merge is MergeTo, but passes the records to add
+func merge(segments []*Segment, bottom bool, add func(Record) error) error {
+	var its []Iterator
+	for _, s := range segments {
+		its = append(its, s.Iter())
+	}
+	m := newMergeIterator(its...)
+	for m.Next() {
+		if r := m.Record(); !bottom || !r.Tombstone {
+			if err := add(r); err != nil {
+				return err
+			}
+		}
+	}
+	return m.Err()
+}
+
+// mergeIterator merges sorted iterators into one. Of the records with the
+// same key, only the newest one is kept. Iterators are given newest first,
+// and within an iterator, a later record of a key is newer.
+type mergeIterator struct {
+	h   mergeHeap
+	rec Record
+	err error
+}
+
+type mergeItem struct {
+	it  Iterator
+	age int // the position of it among the iterators
+}
+
+type mergeHeap []mergeItem
+
+func (h mergeHeap) Len() int { return len(h) }
+func (h mergeHeap) Less(i, j int) bool {
+	a, b := h[i].it.Record().Key, h[j].it.Record().Key
+	return a < b || a == b && h[i].age < h[j].age
+}
+func (h mergeHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+func (h *mergeHeap) Push(x any)   { *h = append(*h, x.(mergeItem)) }
+func (h *mergeHeap) Pop() any {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
+func newMergeIterator(its ...Iterator) *mergeIterator {
+	m := &mergeIterator{}
+	for age, it := range its {
+		m.advance(mergeItem{it, age})
+	}
+	return m
+}
+
+// advance moves item to its next record, and puts it back on the heap
+// unless it's done
+func (m *mergeIterator) advance(item mergeItem) {
+	if item.it.Next() {
+		heap.Push(&m.h, item)
+	} else if err := item.it.Err(); err != nil && m.err == nil {
+		m.err = err
+	}
+}
+
+func (m *mergeIterator) Next() bool {
+	if m.err != nil || len(m.h) == 0 {
+		return false
+	}
+	top := heap.Pop(&m.h).(mergeItem)
+	m.rec = top.it.Record()
+	m.advance(top)
+
+	// the rest of the records with this key are older, except for later
+	// ones from the same iterator
+	for len(m.h) > 0 && m.h[0].it.Record().Key == m.rec.Key {
+		next := heap.Pop(&m.h).(mergeItem)
+		if next.age == top.age {
+			m.rec = next.it.Record()
+		}
+		m.advance(next)
+	}
+	return m.err == nil
+}
+
+func (m *mergeIterator) Record() Record { return m.rec }
+func (m *mergeIterator) Err() error     { return m.err }
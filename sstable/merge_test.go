@@ -0,0 +1,119 @@
+package sstable
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+func TestMerge(t *testing.T) {
+	newest := NewSegment(rec("b", "3"), NewTombstone("c"), rec("e", "3"))
+	middle := NewSegment(rec("a", "2"), rec("b", "2"), rec("d", "2"), rec("d", "2b"))
+	oldest := NewSegment(rec("a", "1"), rec("c", "1"), NewTombstone("e"), rec("f", "1"))
+
+	got := records(t, Merge(newest, middle, oldest))
+	want := []Record{
+		rec("a", "2"), rec("b", "3"), NewTombstone("c"), rec("d", "2b"), rec("e", "3"), rec("f", "1"),
+	}
+	expectRecords(t, want, got)
+
+	var buf bytes.Buffer
+	w := NewWriter(&buf, Options{})
+	if err := MergeTo(w, true, newest, middle, oldest); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	s, err := Open(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = []Record{rec("a", "2"), rec("b", "3"), rec("d", "2b"), rec("e", "3"), rec("f", "1")}
+	expectRecords(t, want, records(t, s))
+
+	if got := records(t, Merge()); len(got) != 0 {
+		t.Errorf("merge of no segments has %d records", len(got))
+	}
+}
+
+func TestMergeStreams(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	opts := Options{BlockSize: 256}
+	model := map[string]string{}
+	var segments []*Segment
+	var readers []*countingReader
+	blocks := 0
+	for i := range 10 {
+		var input []Record
+		for j := range 500 {
+			key := fmt.Sprintf("key%04d", rng.Intn(2000))
+			value := fmt.Sprintf("%d-%d", i, j)
+			input = append(input, rec(key, value))
+		}
+		input = records(t, NewSegment(input...))
+		for _, r := range input {
+			model[r.Key] = string(r.Value)
+		}
+		b := write(t, opts, input...)
+		r := &countingReader{r: bytes.NewReader(b)}
+		s, err := Open(r, int64(len(b)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.reads = 0
+		blocks += len(s.index)
+		// oldest last
+		segments = append([]*Segment{s}, segments...)
+		readers = append(readers, r)
+	}
+
+	var buf bytes.Buffer
+	w := NewWriter(&buf, opts)
+	if err := MergeTo(w, true, segments...); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// each data block is read once
+	reads := 0
+	for _, r := range readers {
+		reads += r.reads
+	}
+	if reads != blocks {
+		t.Errorf("got %d reads, want %d", reads, blocks)
+	}
+
+	s, err := Open(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := records(t, s)
+	if len(got) != len(model) {
+		t.Fatalf("got %d records, want %d", len(got), len(model))
+	}
+	for i, r := range got {
+		if i > 0 && got[i-1].Key >= r.Key {
+			t.Fatalf("records not sorted: %q before %q", got[i-1].Key, r.Key)
+		}
+		if want := model[r.Key]; string(r.Value) != want {
+			t.Errorf("%s: got %q, want %q", r.Key, r.Value, want)
+		}
+	}
+}
+
+func expectRecords(t *testing.T, want, got []Record) {
+	t.Helper()
+	if len(want) != len(got) {
+		t.Fatalf("got %d records, want %d", len(got), len(want))
+	}
+	for i, w := range want {
+		g := got[i]
+		if w.Key != g.Key || !bytes.Equal(w.Value, g.Value) || w.Tombstone != g.Tombstone {
+			t.Errorf("record %d: got %+v, want %+v", i, g, w)
+		}
+	}
+}
@@ -1,38 +1,282 @@
 package sstable
 
 import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
 	"slices"
+	"strings"
 )
 
 type Record struct {
 	Key   string
-	Value int
+	Value []byte
+
+	// Tombstone marks a deleted key, and hides the older records of the key
+	Tombstone bool
 }
 
-func NewRecord(key string, value int) Record {
+func NewRecord(key string, value []byte) Record {
 	return Record{Key: key, Value: value}
 }
 
+func NewTombstone(key string) Record {
+	return Record{Key: key, Tombstone: true}
+}
+
+// Segment is a segment file, sorted by key; see format.go. The filter and
+// index are read when it's opened, and data blocks are read as they're
+// needed.
 type Segment struct {
-	records []Record
+	f      io.ReaderAt
+	name   string // of f, if it has one
+	filter bloom
+	index  []blockHandle
 }
 
+// Open reads the footer, filter and index of the segment file f, which is
+// size bytes
+func Open(f io.ReaderAt, size int64) (*Segment, error) {
+	if size < footerSize {
+		return nil, ErrBadMagic
+	}
+	footer := make([]byte, footerSize)
+	if _, err := f.ReadAt(footer, size-footerSize); err != nil {
+		return nil, err
+	}
+	if binary.BigEndian.Uint64(footer[32:]) != magic {
+		return nil, ErrBadMagic
+	}
+	s := &Segment{f: f}
+	if f, ok := f.(interface{ Name() string }); ok {
+		s.name = f.Name()
+	}
+	var blocks [2][]byte
+	var offsets [2]uint64
+	for i, name := range []string{"filter", "index"} {
+		offset, length := binary.BigEndian.Uint64(footer[16*i:]), binary.BigEndian.Uint64(footer[16*i+8:])
+		if offset > uint64(size-footerSize) || length > uint64(size-footerSize)-offset {
+			return nil, fmt.Errorf("sstable: %s block is out of bounds", name)
+		}
+		var err error
+		if blocks[i], err = s.read(offset, length); err != nil {
+			return nil, err
+		}
+		offsets[i] = offset
+	}
+	index, err := decodeIndex(blocks[1])
+	if err != nil {
+		return nil, s.corrupt(offsets[1], err)
+	}
+	s.filter, s.index = blocks[0], index
+	return s, nil
+}
+
+// NewSegment returns a segment kept in memory. The records are sorted by key
+// first, and records with equal keys stay in the order they're given.
 func NewSegment(r ...Record) *Segment {
-	return &Segment{
-		records: r,
+	records := slices.Clone(r)
+	slices.SortStableFunc(records, func(a, b Record) int { return strings.Compare(a.Key, b.Key) })
+	return fromWriter(func(w *Writer) {
+		for _, r := range records {
+			if err := w.Add(r); err != nil {
+				panic(err)
+			}
+		}
+	})
+}
+
+// fromWriter returns a segment kept in memory with the records that write
+// adds to w
+func fromWriter(write func(w *Writer)) *Segment {
+	var buf bytes.Buffer
+	w := NewWriter(&buf, Options{})
+	write(w)
+	if err := w.Close(); err != nil {
+		panic(err)
+	}
+	s, err := Open(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		panic(err)
 	}
+	return s
 }
 
+// Compact returns a segment kept in memory with the last record of each key
+// in s. It panics if s can't be read.
 func Compact(s *Segment) *Segment {
-	var res Segment
-	for _, rec := range s.records {
-		if i := slices.IndexFunc(res.records, func(r Record) bool {
-			return r.Key == rec.Key
-		}); i == -1 {
-			res.records = append(res.records, rec)
-		} else {
-			res.records[i] = rec
+	return Merge(s)
+}
+
+// readBlock reads data block i
+func (s *Segment) readBlock(i int) ([]byte, error) {
+	return s.read(s.index[i].offset, s.index[i].length)
+}
+
+// read reads the block at offset, and checks and decompresses it
+func (s *Segment) read(offset, length uint64) ([]byte, error) {
+	b := make([]byte, length)
+	if _, err := s.f.ReadAt(b, int64(offset)); err != nil {
+		return nil, err
+	}
+	block, err := decodeBlock(b)
+	if errors.Is(err, ErrUnknownCompression) {
+		return nil, fmt.Errorf("%w in block at offset %d", err, offset)
+	}
+	if err != nil {
+		return nil, s.corrupt(offset, err)
+	}
+	return block, nil
+}
+
+func (s *Segment) corrupt(offset uint64, err error) error {
+	return &CorruptionError{Segment: s.name, Offset: offset, Err: err}
+}
+
+// mayContain reports whether s may have a record with key, going by its
+// filter
+func (s *Segment) mayContain(key string) bool {
+	return s.filter.mayContain(hash(key))
+}
+
+// Get returns the last record with key, and false if there's none. It reads
+// at most one data block, and none if the filter rules out key.
+func (s *Segment) Get(key string) (Record, bool, error) {
+	if !s.mayContain(key) {
+		return Record{}, false, nil
+	}
+	// the last block that starts at or before key
+	i, found := slices.BinarySearchFunc(s.index, key, func(h blockHandle, key string) int {
+		return strings.Compare(h.first, key)
+	})
+	for found && i+1 < len(s.index) && s.index[i+1].first == key {
+		i++
+	}
+	if !found {
+		i--
+	}
+	if i < 0 {
+		return Record{}, false, nil
+	}
+
+	b, err := s.readBlock(i)
+	if err != nil {
+		return Record{}, false, err
+	}
+	var rec Record
+	var ok bool
+	for prev := ""; len(b) > 0; {
+		r, n, err := decodeRecord(b, prev)
+		if err != nil {
+			return Record{}, false, s.corrupt(s.index[i].offset, err)
+		}
+		if r.Key > key {
+			break
+		}
+		if r.Key == key {
+			rec, ok = r, true
+		}
+		b, prev = b[n:], r.Key
+	}
+	return rec, ok, nil
+}
+
+// bounds returns the keys of the first and last record, which are "" if s is
+// empty. It reads the last data block.
+func (s *Segment) bounds() (first, last string, err error) {
+	if len(s.index) == 0 {
+		return "", "", nil
+	}
+	it := &blockIterator{s: s, next: len(s.index) - 1}
+	for it.Next() {
+		last = it.Record().Key
+	}
+	return s.index[0].first, last, it.Err()
+}
+
+// Iter returns an iterator over the records of s in key order. It reads one
+// data block at a time.
+func (s *Segment) Iter() Iterator {
+	return &blockIterator{s: s}
+}
+
+// IterFrom is Iter, but starts at the first record with a key >= key
+func (s *Segment) IterFrom(key string) Iterator {
+	// records with key may start in the last block that starts before it
+	i, _ := slices.BinarySearchFunc(s.index, key, func(h blockHandle, key string) int {
+		return strings.Compare(h.first, key)
+	})
+	return &skipIterator{it: &blockIterator{s: s, next: max(i-1, 0)}, from: key}
+}
+
+// skipIterator skips the records before from
+type skipIterator struct {
+	it   Iterator
+	from string
+}
+
+func (it *skipIterator) Next() bool {
+	for it.it.Next() {
+		if it.it.Record().Key >= it.from {
+			return true
+		}
+	}
+	return false
+}
+
+func (it *skipIterator) Record() Record { return it.it.Record() }
+func (it *skipIterator) Err() error     { return it.it.Err() }
+
+// Iterator goes over records in key order. It's used like a bufio.Scanner:
+//
+//	it := s.Iter()
+//	for it.Next() {
+//		r := it.Record()
+//		...
+//	}
+//	if err := it.Err(); err != nil {
+//		...
+//	}
+type Iterator interface {
+	// Next moves to the next record, and reports whether there is one
+	Next() bool
+	Record() Record
+	Err() error
+}
+
+type blockIterator struct {
+	s     *Segment
+	next  int    // the next block to read
+	block []byte // the rest of the current block
+	rec   Record
+	err   error
+}
+
+func (it *blockIterator) Next() bool {
+	if it.err != nil {
+		return false
+	}
+	prev := it.rec.Key
+	for len(it.block) == 0 {
+		if it.next == len(it.s.index) {
+			return false
+		}
+		if it.block, it.err = it.s.readBlock(it.next); it.err != nil {
+			return false
 		}
+		it.next++
+		prev = ""
 	}
-	return &res
+	r, n, err := decodeRecord(it.block, prev)
+	if err != nil {
+		it.err = it.s.corrupt(it.s.index[it.next-1].offset, err)
+		return false
+	}
+	it.rec, it.block = r, it.block[n:]
+	return true
 }
+
+func (it *blockIterator) Record() Record { return it.rec }
+func (it *blockIterator) Err() error     { return it.err }
@@ -0,0 +1,123 @@
+package sstable
+
+import (
+	"encoding/binary"
+	"io"
+)
+
+const DefaultBlockSize = 4096
+
+type Options struct {
+	// BlockSize is the size a data block grows to before a new one is
+	// started; defaults to DefaultBlockSize
+	BlockSize int
+
+	// MemtableSize is the size of the records a DB keeps in memory before
+	// they're written to a segment; defaults to DefaultMemtableSize
+	MemtableSize int
+
+	// BloomBits is the bits per key of the Bloom filter of a segment;
+	// defaults to DefaultBloomBits, and a negative number means no filter
+	BloomBits int
+
+	// Compression compresses data blocks; nil means none
+	Compression Compression
+
+	// Compaction picks the segments a DB merges; defaults to Leveled
+	Compaction CompactionStrategy
+}
+
+// Writer writes records to a segment file; see format.go. Records must be
+// added in key order. Records with equal keys are kept, and Get returns the
+// last one.
+type Writer struct {
+	w    io.Writer
+	opts Options
+
+	block  []byte
+	out    []byte // block as it's written
+	first  string // key of the first record in block
+	last   string // key of the last record added
+	n      int    // records added
+	offset uint64 // where block goes
+	index  []blockHandle
+	hashes []uint64 // of the keys, for the filter
+	err    error
+}
+
+func NewWriter(w io.Writer, opts Options) *Writer {
+	if opts.BlockSize == 0 {
+		opts.BlockSize = DefaultBlockSize
+	}
+	if opts.BloomBits == 0 {
+		opts.BloomBits = DefaultBloomBits
+	}
+	return &Writer{w: w, opts: opts}
+}
+
+func (w *Writer) Add(r Record) error {
+	if w.err != nil {
+		return w.err
+	}
+	if w.n > 0 && r.Key < w.last {
+		return ErrUnsorted
+	}
+	prev := w.last
+	if len(w.block) == 0 {
+		w.first, prev = r.Key, ""
+	}
+	if w.opts.BloomBits > 0 && (w.n == 0 || r.Key != w.last) {
+		w.hashes = append(w.hashes, hash(r.Key))
+	}
+	w.block = appendRecord(w.block, prev, r)
+	w.last = r.Key
+	w.n++
+	if len(w.block) >= w.opts.BlockSize {
+		w.flush()
+	}
+	return w.err
+}
+
+// flush writes the current data block
+func (w *Writer) flush() {
+	if len(w.block) == 0 || w.err != nil {
+		return
+	}
+	w.out = appendBlock(w.out[:0], w.block, w.opts.Compression)
+	h := blockHandle{first: w.first, offset: w.offset, length: uint64(len(w.out))}
+	w.write(w.out)
+	w.index = append(w.index, h)
+	w.block = w.block[:0]
+}
+
+func (w *Writer) write(b []byte) {
+	if w.err != nil {
+		return
+	}
+	_, w.err = w.w.Write(b)
+	w.offset += uint64(len(b))
+}
+
+// Close writes the last data block, the filter block, the index block and
+// the footer. It does not close the underlying writer.
+func (w *Writer) Close() error {
+	w.flush()
+	var filter bloom
+	if len(w.hashes) > 0 {
+		filter = newBloom(w.hashes, w.opts.BloomBits)
+	}
+	var index []byte
+	for _, h := range w.index {
+		index = appendHandle(index, h)
+	}
+	var footer []byte
+	for _, b := range [][]byte{filter, index} {
+		b = appendBlock(nil, b, nil)
+		footer = binary.BigEndian.AppendUint64(footer, w.offset)
+		footer = binary.BigEndian.AppendUint64(footer, uint64(len(b)))
+		w.write(b)
+	}
+	footer = binary.BigEndian.AppendUint64(footer, magic)
+	w.write(footer)
+	return w.err
+}
@@ -0,0 +1,133 @@
+package sstable
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+)
+
+// countingReader counts calls to ReadAt
+type countingReader struct {
+	r     io.ReaderAt
+	reads int
+}
+
+func (c *countingReader) ReadAt(b []byte, off int64) (int, error) {
+	c.reads++
+	return c.r.ReadAt(b, off)
+}
+
+func write(t *testing.T, opts Options, records ...Record) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := NewWriter(&buf, opts)
+	for _, r := range records {
+		if err := w.Add(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestWriter(t *testing.T) {
+	var input []Record
+	raw := 0
+	for i := range 1000 {
+		r := rec(fmt.Sprintf("key%05d", 2*i), fmt.Sprintf("value %d", i))
+		input = append(input, r)
+		raw += len(r.Key) + len(r.Value)
+	}
+	b := write(t, Options{BlockSize: 256}, input...)
+	f := &countingReader{r: bytes.NewReader(b)}
+	s, err := Open(f, int64(len(b)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.index) < 10 {
+		t.Fatalf("want many blocks, got %d", len(s.index))
+	}
+	// keys share most of their bytes with the key before
+	if len(b) >= raw {
+		t.Errorf("segment is %d bytes, but the records are only %d", len(b), raw)
+	}
+
+	for i, r := range input {
+		f.reads = 0
+		got, ok, err := s.Get(r.Key)
+		if err != nil || !ok || !bytes.Equal(got.Value, r.Value) {
+			t.Fatalf("Get(%q) = %q, %t, %v; want %q", r.Key, got.Value, ok, err, r.Value)
+		}
+		if f.reads != 1 {
+			t.Fatalf("Get(%q) read %d times; want 1", r.Key, f.reads)
+		}
+		missing := fmt.Sprintf("key%05d", 2*i+1)
+		if _, ok, err := s.Get(missing); ok || err != nil {
+			t.Fatalf("Get(%q) = %t, %v; want nothing", missing, ok, err)
+		}
+	}
+	if _, ok, err := s.Get("a"); ok || err != nil {
+		t.Fatalf("Get before the first key = %t, %v; want nothing", ok, err)
+	}
+
+	got := records(t, s)
+	if len(got) != len(input) {
+		t.Fatalf("got %d records, want %d", len(got), len(input))
+	}
+	for i := range got {
+		if got[i].Key != input[i].Key || !bytes.Equal(got[i].Value, input[i].Value) {
+			t.Fatalf("record %d = %v; want %v", i, got[i], input[i])
+		}
+	}
+}
+
+// Records with equal keys may span blocks, and Get finds the last one
+func TestWriterDuplicates(t *testing.T) {
+	var input []Record
+	input = append(input, rec("a", "first"))
+	for i := range 100 {
+		input = append(input, rec("b", fmt.Sprint(i)))
+	}
+	input = append(input, rec("c", "last"))
+	b := write(t, Options{BlockSize: 32}, input...)
+	s, err := Open(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for key, want := range map[string]string{"a": "first", "b": "99", "c": "last"} {
+		if r, ok, err := s.Get(key); err != nil || !ok || string(r.Value) != want {
+			t.Errorf("Get(%q) = %q, %t, %v; want %q", key, r.Value, ok, err, want)
+		}
+	}
+}
+
+func TestWriterUnsorted(t *testing.T) {
+	w := NewWriter(io.Discard, Options{})
+	if err := w.Add(rec("b", "")); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Add(rec("a", "")); !errors.Is(err, ErrUnsorted) {
+		t.Fatalf("want ErrUnsorted, got %v", err)
+	}
+}
+
+func TestOpen(t *testing.T) {
+	empty := write(t, Options{})
+	s, err := Open(bytes.NewReader(empty), int64(len(empty)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, err := s.Get("a"); ok || err != nil {
+		t.Fatalf("Get on an empty segment = %t, %v", ok, err)
+	}
+
+	for _, b := range [][]byte{nil, []byte("not a segment file at all, but long enough")} {
+		if _, err := Open(bytes.NewReader(b), int64(len(b))); !errors.Is(err, ErrBadMagic) {
+			t.Errorf("Open(%q): want ErrBadMagic, got %v", b, err)
+		}
+	}
+}